@@ -0,0 +1,258 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Top-Ranger/writergo/registry"
+)
+
+// Roles of users on a document.
+// Commenters currently have the same permissions as viewers.
+const (
+	roleNone      = "none"
+	roleViewer    = "viewer"
+	roleCommenter = "commenter"
+	roleEditor    = "editor"
+	roleOwner     = "owner"
+)
+
+// roleLevel orders the roles by their permissions.
+var roleLevel = map[string]int{
+	roleNone:      0,
+	roleViewer:    1,
+	roleCommenter: 2,
+	roleEditor:    3,
+	roleOwner:     4,
+}
+
+// reservedKeyPrefix marks keys of the DataSafe which are used internally and can not be opened as documents.
+const reservedKeyPrefix = "~"
+
+// aclKeyPrefix is the prefix of the keys the ACLs are stored under in the DataSafe.
+const aclKeyPrefix = "~acl/"
+
+// maxDocumentKeyLength returns the maximum length of a document key in bytes, 0 if there is no limit.
+// The ACL of a document is stored under a longer key, so the limit of the DataSafe must also fit the prefix.
+func maxDocumentKeyLength() int {
+	l, ok := ds.(registry.KeyLimiter)
+	if !ok {
+		return 0
+	}
+	return l.MaxKeyLength() - len(aclKeyPrefix)
+}
+
+// documentACL contains the roles of users and groups on a document.
+type documentACL struct {
+	Users  map[string]string // user -> role
+	Groups map[string]string // group -> role
+	Public string            // role of everyone else, including anonymous users
+}
+
+var (
+	aclLock sync.Mutex
+	// memoryACLs keeps the ACLs if the DataSafe does not store data permanently.
+	memoryACLs = make(map[string]memoryACL)
+)
+
+// memoryACL is an ACL kept in memory.
+type memoryACL struct {
+	acl   documentACL
+	saved time.Time
+}
+
+// hasRole reports whether role grants at least the permissions of min.
+func hasRole(role, min string) bool {
+	return roleLevel[role] >= roleLevel[min]
+}
+
+// isAdmin reports whether the user may manage all documents.
+func isAdmin(id registry.Identity) bool {
+	if id.Anonymous() {
+		return false
+	}
+	for i := range config.Admins {
+		if config.Admins[i] == id.User {
+			return true
+		}
+	}
+	return false
+}
+
+// role returns the highest role the ACL grants to the user.
+// The role of API tokens is limited by their scopes.
+func (a documentACL) role(id registry.Identity) string {
+	r := a.grantedRole(id)
+	if limit := scopeLimit(id.Scopes); !hasRole(limit, r) {
+		return limit
+	}
+	return r
+}
+
+// grantedRole returns the highest role the ACL grants to the user, ignoring scopes.
+func (a documentACL) grantedRole(id registry.Identity) string {
+	if isAdmin(id) {
+		return roleOwner
+	}
+	best := a.Public
+	if best == "" {
+		best = roleNone
+	}
+	if id.Anonymous() {
+		return best
+	}
+	if r, ok := a.Users[id.User]; ok && hasRole(r, best) {
+		best = r
+	}
+	for _, g := range id.Groups {
+		if r, ok := a.Groups[g]; ok && hasRole(r, best) {
+			best = r
+		}
+	}
+	return best
+}
+
+// validate checks that all roles are known and that the document keeps an owner.
+func (a documentACL) validate() error {
+	owner := false
+	for _, entries := range []map[string]string{a.Users, a.Groups} {
+		for name, r := range entries {
+			if strings.TrimSpace(name) == "" {
+				return errors.New("empty name")
+			}
+			if _, ok := roleLevel[r]; !ok || r == roleNone {
+				return fmt.Errorf("unknown role '%s'", r)
+			}
+			if r == roleOwner {
+				owner = true
+			}
+		}
+	}
+	if !owner {
+		return errors.New("no owner")
+	}
+	switch a.Public {
+	case "", roleNone, roleViewer, roleCommenter, roleEditor:
+	default:
+		return fmt.Errorf("role '%s' can not be granted to everyone", a.Public)
+	}
+	return nil
+}
+
+// loadACL returns the ACL of a document.
+// The bool indicates whether the document has an ACL.
+func loadACL(key string) (documentACL, bool, error) {
+	if !ds.IsPermanent() {
+		aclLock.Lock()
+		defer aclLock.Unlock()
+		a, ok := memoryACLs[key]
+		return a.acl, ok, nil
+	}
+
+	data, err := ds.LoadWriter(strings.Join([]string{aclKeyPrefix, key}, ""))
+	if err != nil {
+		return documentACL{}, false, fmt.Errorf("can not load ACL: %w", err)
+	}
+	if data == "" {
+		return documentACL{}, false, nil
+	}
+	var a documentACL
+	err = json.Unmarshal([]byte(data), &a)
+	if err != nil {
+		return documentACL{}, false, fmt.Errorf("can not parse ACL: %w", err)
+	}
+	return a, true, nil
+}
+
+// forgetMemoryACLs removes the ACLs kept in memory of all documents which are not open and were not changed for the given time.
+// Since their content is not stored either, they are new documents when opened again.
+func forgetMemoryACLs(open func(key string) bool, age time.Duration) {
+	aclLock.Lock()
+	defer aclLock.Unlock()
+	for k, a := range memoryACLs {
+		if !open(k) && time.Since(a.saved) > age {
+			delete(memoryACLs, k)
+		}
+	}
+}
+
+// saveACL stores the ACL of a document.
+func saveACL(key string, a documentACL) error {
+	if !ds.IsPermanent() {
+		aclLock.Lock()
+		defer aclLock.Unlock()
+		memoryACLs[key] = memoryACL{acl: a, saved: time.Now()}
+		return nil
+	}
+
+	b, err := json.Marshal(&a)
+	if err != nil {
+		return fmt.Errorf("can not encode ACL: %w", err)
+	}
+	return ds.SaveWriter(strings.Join([]string{aclKeyPrefix, key}, ""), string(b))
+}
+
+// documentRole returns the role of the user on a document.
+// Documents without an ACL grant config.DefaultRole to everyone.
+func documentRole(key string, id registry.Identity) (string, error) {
+	a, ok, err := loadACL(key)
+	if err != nil {
+		return roleNone, err
+	}
+	if !ok {
+		a = documentACL{Public: config.DefaultRole}
+	}
+	return a.role(id), nil
+}
+
+// claimDocument makes an authenticated user the owner of a new document.
+// Documents which already have an ACL or content are not changed.
+// API tokens only claim documents if they have the admin scope.
+func claimDocument(key string, id registry.Identity) error {
+	if id.Anonymous() || !hasRole(scopeLimit(id.Scopes), roleOwner) {
+		return nil
+	}
+
+	_, ok, err := loadACL(key)
+	if err != nil || ok {
+		return err
+	}
+
+	writerMapLock.Lock()
+	w := writerMap[key]
+	writerMapLock.Unlock()
+	if w != nil {
+		w.currentL.Lock()
+		current := w.current
+		w.currentL.Unlock()
+		if current != "" {
+			return nil
+		}
+	} else {
+		current, err := ds.LoadWriter(key)
+		if err != nil || current != "" {
+			return err
+		}
+	}
+
+	return saveACL(key, documentACL{Users: map[string]string{id.User: roleOwner}, Public: config.DefaultRole})
+}
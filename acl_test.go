@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Top-Ranger/writergo/datasafe"
+	"github.com/Top-Ranger/writergo/registry"
+)
+
+func TestForgetMemoryACLs(t *testing.T) {
+	aclLock.Lock()
+	memoryACLs = map[string]memoryACL{
+		"open":   {acl: documentACL{Public: roleOwner}, saved: time.Now().Add(-time.Hour)},
+		"closed": {acl: documentACL{Public: roleOwner}, saved: time.Now().Add(-time.Hour)},
+		"new":    {acl: documentACL{Public: roleOwner}, saved: time.Now()},
+	}
+	aclLock.Unlock()
+
+	forgetMemoryACLs(func(key string) bool { return key == "open" }, time.Minute)
+
+	aclLock.Lock()
+	defer aclLock.Unlock()
+	for key, want := range map[string]bool{"open": true, "closed": false, "new": true} {
+		if _, ok := memoryACLs[key]; ok != want {
+			t.Errorf("%s: kept %t, want %t", key, ok, want)
+		}
+	}
+}
+
+// useDataSafe replaces the DataSafe for the duration of the test.
+func useDataSafe(t *testing.T, d registry.DataSafe) {
+	t.Helper()
+	testGlobals()
+	old := ds
+	ds = d
+	t.Cleanup(func() { ds = old })
+}
+
+func TestUnreadableACLDenies(t *testing.T) {
+	dir := t.TempDir()
+	f := &datasafe.File{}
+	err := f.LoadConfig([]byte(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(f.FlushAndClose)
+	useDataSafe(t, f)
+
+	err = saveACL("protected", documentACL{Users: map[string]string{"alice": roleOwner}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("want only the ACL in %s, got %v (%v)", dir, entries, err)
+	}
+	// Reading a directory fails even for root
+	path := filepath.Join(dir, entries[0].Name())
+	err = os.Remove(path)
+	if err == nil {
+		err = os.Mkdir(path, 0700)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mallory := registry.Identity{User: "mallory"}
+	role, err := documentRole("protected", mallory)
+	if err == nil || role != roleNone {
+		t.Errorf("documentRole returned %s (%v), want an error", role, err)
+	}
+	if claimDocument("protected", mallory) == nil {
+		t.Error("claimDocument did not fail")
+	}
+
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	rootHandle(rec, r.WithContext(context.WithValue(r.Context(), identityContextKey{}, mallory)))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("rootHandle returned %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
+
+// limitedDataSafe only supports keys up to 20 bytes.
+type limitedDataSafe struct {
+	datasafe.Nil
+}
+
+func (*limitedDataSafe) MaxKeyLength() int { return 20 }
+
+func TestDocumentKeyLength(t *testing.T) {
+	useDataSafe(t, &limitedDataSafe{})
+
+	for key, want := range map[string]int{
+		"short":                  http.StatusOK,
+		"exactly-15-byte":        http.StatusOK,
+		"exactly-16-bytes":       http.StatusRequestURITooLong,
+		"much-too-long-document": http.StatusRequestURITooLong,
+	} {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, strings.Join([]string{"/", key}, ""), nil)
+		rootHandle(rec, r.WithContext(context.WithValue(r.Context(), identityContextKey{}, registry.Identity{})))
+		if rec.Code != want {
+			t.Errorf("%s: got status %d, want %d", key, rec.Code, want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Top-Ranger/writergo/registry"
+)
+
+// Actions recorded in the audit log.
+const (
+	auditView       = "view"        // document page loaded
+	auditDenied     = "denied"      // access to a document denied
+	auditOpen       = "open"        // websocket connection added to a document
+	auditClose      = "close"       // websocket connection removed from a document
+	auditWriteToken = "write_token" // connection got the write permission
+	auditSave       = "save"        // document saved to the DataSafe
+	auditExport     = "export"      // client exported the document
+	auditACL        = "acl"         // roles of the document changed
+	auditDropped    = "dropped"     // events were dropped because the sink could not keep up
+)
+
+// auditQueueSize is the number of events which can be queued before further events are dropped.
+// Dropped events are recorded as a single auditDropped event, so the gap is visible in the audit log.
+const auditQueueSize = 1024
+
+// auditDropLogInterval is the number of dropped events after which the drops are logged again.
+const auditDropLogInterval = 1000
+
+var (
+	auditSink   registry.AuditSink
+	auditQueue  = make(chan auditEntry, auditQueueSize)
+	auditDone   = make(chan struct{})
+	auditLock   sync.RWMutex
+	auditClosed bool
+
+	auditDroppedTotal      atomic.Int64
+	auditDroppedUnrecorded atomic.Int64 // dropped events not yet recorded as auditDropped
+)
+
+// auditEntry is a queued event together with the number of events dropped right before it.
+type auditEntry struct {
+	e       registry.AuditEvent
+	dropped int64
+}
+
+// startAudit starts recording events to the configured sink.
+func startAudit() {
+	go func() {
+		for entry := range auditQueue {
+			if entry.dropped != 0 {
+				recordDropped(entry.dropped, entry.e.Time)
+			}
+			err := auditSink.Record(entry.e)
+			if err != nil {
+				log.Println("audit: can not record event:", err)
+			}
+		}
+		if n := auditDroppedUnrecorded.Swap(0); n != 0 {
+			recordDropped(n, time.Now())
+		}
+		close(auditDone)
+	}()
+}
+
+// stopAudit records all queued events and closes the sink.
+// Later events are discarded.
+func stopAudit() {
+	auditLock.Lock()
+	auditClosed = true
+	close(auditQueue)
+	auditLock.Unlock()
+
+	<-auditDone
+	if n := auditDroppedTotal.Load(); n != 0 {
+		log.Println("audit: dropped events because the queue was full:", n)
+	}
+	auditSink.Close()
+}
+
+// audit queues an event for the audit log.
+// Events are recorded in the background, so callers may hold locks.
+// If the sink can not keep up and the queue is full, the event is dropped and recorded as dropped later.
+func audit(e registry.AuditEvent) {
+	auditLock.RLock()
+	defer auditLock.RUnlock()
+
+	if auditClosed || auditSink == nil {
+		return
+	}
+	e.Time = time.Now()
+	dropped := auditDroppedUnrecorded.Swap(0)
+	select {
+	case auditQueue <- auditEntry{e: e, dropped: dropped}:
+	default:
+		auditDroppedUnrecorded.Add(dropped + 1)
+		n := auditDroppedTotal.Add(1)
+		if n%auditDropLogInterval == 1 {
+			log.Println("audit: queue full, dropping events (dropped so far):", n)
+		}
+	}
+}
+
+// recordDropped records that n events were dropped before the given time.
+func recordDropped(n int64, t time.Time) {
+	err := auditSink.Record(registry.AuditEvent{Time: t, Action: auditDropped, Detail: fmt.Sprintf("%d events dropped because the queue was full", n)})
+	if err != nil {
+		log.Println("audit: can not record dropped events:", err)
+	}
+}
+
+// auditRequest queues an event for a HTTP request to a document.
+func auditRequest(r *http.Request, action, key, detail string) {
+	audit(registry.AuditEvent{
+		Action:     action,
+		Document:   key,
+		RemoteAddr: requestClient(r),
+		User:       requestIdentity(r).User,
+		Detail:     detail,
+	})
+}
+
+// auditConnection queues an event for a connection of the writer.
+// Caller must hold w.l.
+func (w *writer) auditConnection(action, key, detail string) {
+	e := registry.AuditEvent{Action: action, Document: w.Key, Connection: key, Detail: detail}
+	if c := w.connections[key]; c != nil {
+		e.RemoteAddr = c.remote
+		e.User = c.identity.User
+	}
+	audit(e)
+}
@@ -0,0 +1 @@
+CREATE TABLE writergo.audit (id BIGINT NOT NULL AUTO_INCREMENT, time BIGINT NOT NULL, action VARCHAR(50) NOT NULL, document VARCHAR(600) NOT NULL, connection VARCHAR(50) NOT NULL, remote_addr VARCHAR(100) NOT NULL, user VARCHAR(600) NOT NULL, detail TEXT NOT NULL, PRIMARY KEY(id), INDEX(document), INDEX(time));
@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/Top-Ranger/writergo/registry"
+)
+
+func init() {
+	err := registry.RegisterAuditSink(&JSONLines{}, "JSONLines")
+	if err != nil {
+		panic(err)
+	}
+	err = registry.RegisterAuditSink(&JSONLines{}, "jsonlines")
+	if err != nil {
+		panic(err)
+	}
+}
+
+// ErrJSONLinesNotConfigured is returned when the sink is used before it is configured
+var ErrJSONLinesNotConfigured = errors.New("jsonlines: usage before configuration is used")
+
+// JSONLinesConfig is the configuration of the JSONLines sink.
+// The configuration may also be the plain path.
+type JSONLinesConfig struct {
+	Path string
+	// Sync writes every event to disk before the next one is recorded.
+	Sync bool
+}
+
+// JSONLines appends each event as a JSON object on its own line to a file.
+// The file is opened in append mode, so it can be rotated by truncating it.
+type JSONLines struct {
+	l    sync.Mutex
+	f    *os.File
+	sync bool
+}
+
+func (j *JSONLines) Record(e registry.AuditEvent) error {
+	b, err := json.Marshal(&e)
+	if err != nil {
+		return fmt.Errorf("jsonlines: can not encode event: %w", err)
+	}
+	b = append(b, '\n')
+
+	j.l.Lock()
+	defer j.l.Unlock()
+
+	if j.f == nil {
+		return ErrJSONLinesNotConfigured
+	}
+	_, err = j.f.Write(b)
+	if err != nil {
+		return fmt.Errorf("jsonlines: can not write event: %w", err)
+	}
+	if j.sync {
+		err = j.f.Sync()
+		if err != nil {
+			return fmt.Errorf("jsonlines: can not sync file: %w", err)
+		}
+	}
+	return nil
+}
+
+func (j *JSONLines) LoadConfig(data []byte) error {
+	c := JSONLinesConfig{}
+	err := registry.DecodeConfig(data, &c, func(s string) { c.Path = s })
+	if err != nil {
+		return fmt.Errorf("jsonlines: %w", err)
+	}
+	if c.Path == "" {
+		return errors.New("jsonlines: no path given, set AuditSinkConfig to the target file or to an object with 'Path'")
+	}
+
+	f, err := os.OpenFile(c.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("jsonlines: can not open '%s': %w", c.Path, err)
+	}
+
+	j.l.Lock()
+	defer j.l.Unlock()
+	j.f = f
+	j.sync = c.Sync
+	return nil
+}
+
+func (j *JSONLines) Close() {
+	j.l.Lock()
+	defer j.l.Unlock()
+
+	if j.f == nil {
+		return
+	}
+	err := j.f.Close()
+	if err != nil {
+		log.Println("jsonlines: can not close file:", err)
+	}
+	j.f = nil
+}
@@ -0,0 +1,92 @@
+//go:build mysql
+
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Top-Ranger/writergo/registry"
+	"github.com/go-sql-driver/mysql"
+)
+
+func init() {
+	err := registry.RegisterAuditSink(&MySQL{}, "MySQL")
+	if err != nil {
+		panic(err)
+	}
+	err = registry.RegisterAuditSink(&MySQL{}, "mysql")
+	if err != nil {
+		panic(err)
+	}
+}
+
+// ErrMySQLNotConfigured is returned when the sink is used before it is configured
+var ErrMySQLNotConfigured = errors.New("mysql: usage before configuration is used")
+
+// MySQLConfig is the configuration of the MySQL sink.
+// The configuration may also be the plain DSN.
+type MySQLConfig struct {
+	DSN string
+}
+
+// MySQL stores the events in the table 'audit', see create.sql.
+type MySQL struct {
+	db *sql.DB
+}
+
+func (m *MySQL) Record(e registry.AuditEvent) error {
+	if m.db == nil {
+		return ErrMySQLNotConfigured
+	}
+
+	_, err := m.db.Exec("INSERT INTO audit (time, action, document, connection, remote_addr, user, detail) VALUES (?,?,?,?,?,?,?)", e.Time.UnixMilli(), e.Action, e.Document, e.Connection, e.RemoteAddr, e.User, e.Detail)
+	return err
+}
+
+func (m *MySQL) LoadConfig(data []byte) error {
+	c := MySQLConfig{}
+	err := registry.DecodeConfig(data, &c, func(s string) { c.DSN = s })
+	if err != nil {
+		return fmt.Errorf("mysql: %w", err)
+	}
+
+	if c.DSN == "" {
+		return errors.New("mysql: no DSN given, set AuditSinkConfig to the DSN or to an object with 'DSN'")
+	}
+	_, err = mysql.ParseDSN(c.DSN)
+	if err != nil {
+		// Do not include the DSN, it usually contains the password
+		return fmt.Errorf("mysql: invalid DSN: %w", err)
+	}
+
+	db, err := sql.Open("mysql", c.DSN)
+	if err != nil {
+		return fmt.Errorf("mysql: can not open database: %w", err)
+	}
+	m.db = db
+	return nil
+}
+
+func (m *MySQL) Close() {
+	if m.db == nil {
+		return
+	}
+	m.db.Close()
+}
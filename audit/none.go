@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bytes"
+	"log"
+
+	"github.com/Top-Ranger/writergo/registry"
+)
+
+func init() {
+	err := registry.RegisterAuditSink(&None{}, "")
+	if err != nil {
+		panic(err)
+	}
+	err = registry.RegisterAuditSink(&None{}, "None")
+	if err != nil {
+		panic(err)
+	}
+	err = registry.RegisterAuditSink(&None{}, "none")
+	if err != nil {
+		panic(err)
+	}
+}
+
+// None discards all events, so no audit log is kept.
+type None struct{}
+
+func (*None) Record(e registry.AuditEvent) error {
+	return nil
+}
+
+func (*None) LoadConfig(data []byte) error {
+	if len(bytes.TrimSpace(data)) != 0 {
+		log.Println("none: AuditSinkConfig is ignored, since no audit log is kept")
+	}
+	return nil
+}
+
+func (*None) Close() {}
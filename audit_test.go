@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Top-Ranger/writergo/registry"
+)
+
+// blockingSink blocks recording events until unblock is closed.
+type blockingSink struct {
+	unblock chan struct{}
+
+	l        sync.Mutex
+	recorded []registry.AuditEvent
+}
+
+func (b *blockingSink) Record(e registry.AuditEvent) error {
+	<-b.unblock
+	b.l.Lock()
+	defer b.l.Unlock()
+	b.recorded = append(b.recorded, e)
+	return nil
+}
+
+func (*blockingSink) LoadConfig(data []byte) error { return nil }
+func (*blockingSink) Close()                       {}
+
+func TestAuditDoesNotBlock(t *testing.T) {
+	sink := &blockingSink{unblock: make(chan struct{})}
+	auditSink = sink
+	startAudit()
+
+	const events = 2 * auditQueueSize
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < events; i++ {
+			audit(registry.AuditEvent{Action: auditView, Document: "doc"})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("audit blocked while the sink was slow")
+	}
+	close(sink.unblock)
+	for len(auditQueue) != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	dropped := auditDroppedTotal.Load()
+	if dropped == 0 {
+		t.Error("no events were dropped")
+	}
+	audit(registry.AuditEvent{Action: auditView, Document: "after"})
+	stopAudit()
+
+	// The dropped events are recorded right before the first event queued after them
+	sink.l.Lock()
+	defer sink.l.Unlock()
+	if want := events - int(dropped) + 2; len(sink.recorded) != want {
+		t.Fatalf("recorded %d events, want %d", len(sink.recorded), want)
+	}
+	gap := sink.recorded[len(sink.recorded)-2]
+	if gap.Action != auditDropped || gap.Detail != fmt.Sprintf("%d events dropped because the queue was full", dropped) {
+		t.Errorf("got %+v, want %d dropped events", gap, dropped)
+	}
+	if last := sink.recorded[len(sink.recorded)-1]; last.Document != "after" {
+		t.Errorf("last event is %+v", last)
+	}
+}
@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/Top-Ranger/writergo/registry"
+)
+
+var authenticator registry.Authenticator
+
+type identityContextKey struct{}
+
+// authenticate wraps a handler so it is only called for authenticated users.
+// Requests with a bearer token are authenticated through the API tokens, all others through the authenticator.
+// The identity of the user is available through requestIdentity.
+func authenticate(h http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if token, ok := bearerToken(r); ok {
+			id, ok := tokenIdentity(token)
+			if !ok {
+				log.Printf("auth: invalid API token from %s", r.RemoteAddr)
+				auditRequest(r, auditDenied, strings.TrimLeft(r.URL.Path, "/"), "invalid API token")
+				rw.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				http.Error(rw, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			h(rw, r.WithContext(context.WithValue(r.Context(), identityContextKey{}, id)))
+			return
+		}
+
+		id, ok := authenticator.Authenticate(rw, r)
+		if !ok {
+			return
+		}
+		h(rw, r.WithContext(context.WithValue(r.Context(), identityContextKey{}, id)))
+	}
+}
+
+// requestIdentity returns the identity of the user sending the request.
+func requestIdentity(r *http.Request) registry.Identity {
+	id, _ := r.Context().Value(identityContextKey{}).(registry.Identity)
+	return id
+}
@@ -0,0 +1,101 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/Top-Ranger/writergo/registry"
+)
+
+func init() {
+	err := registry.RegisterAuthenticator(&Header{}, "Header")
+	if err != nil {
+		panic(err)
+	}
+	err = registry.RegisterAuthenticator(&Header{}, "header")
+	if err != nil {
+		panic(err)
+	}
+}
+
+// HeaderConfig is the configuration of the Header authenticator.
+type HeaderConfig struct {
+	UserHeader     string   // defaults to X-Forwarded-User
+	NameHeader     string   // optional
+	GroupsHeader   string   // optional, groups are separated by commas
+	TrustedProxies []string // IP addresses or CIDR ranges of the reverse proxies
+}
+
+// Header trusts a reverse proxy which authenticates the users and passes the identity in request headers.
+// Requests not coming from a trusted proxy are rejected, since anyone could set the headers.
+type Header struct {
+	c       HeaderConfig
+	trusted Networks
+}
+
+func (h *Header) Authenticate(rw http.ResponseWriter, r *http.Request) (registry.Identity, bool) {
+	if !h.trusted.Contains(r.RemoteAddr) {
+		log.Printf("header: request from untrusted address %s", r.RemoteAddr)
+		http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return registry.Identity{}, false
+	}
+
+	id := registry.Identity{User: strings.TrimSpace(r.Header.Get(h.c.UserHeader))}
+	if id.User == "" {
+		http.Error(rw, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return registry.Identity{}, false
+	}
+	if h.c.NameHeader != "" {
+		id.Name = strings.TrimSpace(r.Header.Get(h.c.NameHeader))
+	}
+	if h.c.GroupsHeader != "" {
+		for _, g := range strings.Split(r.Header.Get(h.c.GroupsHeader), ",") {
+			g = strings.TrimSpace(g)
+			if g != "" {
+				id.Groups = append(id.Groups, g)
+			}
+		}
+	}
+	return id, true
+}
+
+func (h *Header) LoadConfig(data []byte) error {
+	c := HeaderConfig{}
+	err := registry.DecodeConfig(data, &c, func(s string) {})
+	if err != nil {
+		return fmt.Errorf("header: %w", err)
+	}
+	if len(c.TrustedProxies) == 0 {
+		return errors.New("header: no TrustedProxies given, set AuthenticatorConfig to an object with 'TrustedProxies'")
+	}
+	if c.UserHeader == "" {
+		c.UserHeader = "X-Forwarded-User"
+	}
+
+	trusted, err := ParseNetworks(c.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("header: invalid TrustedProxies: %w", err)
+	}
+
+	h.c = c
+	h.trusted = trusted
+	return nil
+}
@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHeader(t *testing.T) {
+	h := &Header{}
+	err := h.LoadConfig([]byte(`{"TrustedProxies": ["127.0.0.1", "10.0.0.0/8", "::1"], "NameHeader": "X-Forwarded-Name", "GroupsHeader": "X-Forwarded-Groups"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		remote string
+		user   string
+		want   int // status if rejected, 0 if accepted
+	}{
+		{"trusted address", "127.0.0.1:1234", "alice", 0},
+		{"trusted range", "10.1.2.3:1234", "alice", 0},
+		{"trusted IPv6", "[::1]:1234", "alice", 0},
+		{"untrusted address", "192.0.2.1:1234", "alice", http.StatusForbidden},
+		{"untrusted IPv6", "[2001:db8::1]:1234", "alice", http.StatusForbidden},
+		{"address outside range", "11.0.0.1:1234", "alice", http.StatusForbidden},
+		{"untrusted address without user", "192.0.2.1:1234", "", http.StatusForbidden},
+		{"trusted address without user", "127.0.0.1:1234", "", http.StatusUnauthorized},
+		{"trusted address with blank user", "127.0.0.1:1234", "  ", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			r.Header.Set("X-Forwarded-User", tt.user)
+			r.Header.Set("X-Forwarded-Name", "Alice")
+			r.Header.Set("X-Forwarded-Groups", "staff, ,admins")
+			id, ok := h.Authenticate(rec, r)
+			if tt.want != 0 {
+				if ok || rec.Code != tt.want || id.User != "" {
+					t.Errorf("got %+v (%t) with status %d, want status %d", id, ok, rec.Code, tt.want)
+				}
+				return
+			}
+			if !ok || id.User != tt.user || id.Name != "Alice" || strings.Join(id.Groups, ",") != "staff,admins" {
+				t.Errorf("got %+v (%t)", id, ok)
+			}
+		})
+	}
+}
+
+func TestHeaderNeedsTrustedProxies(t *testing.T) {
+	for _, c := range []string{``, `{}`, `{"TrustedProxies": []}`, `{"TrustedProxies": ["not an address"]}`} {
+		err := (&Header{}).LoadConfig([]byte(c))
+		if err == nil {
+			t.Errorf("%s: accepted", c)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/Top-Ranger/writergo/registry"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func init() {
+	err := registry.RegisterAuthenticator(&Htpasswd{}, "Htpasswd")
+	if err != nil {
+		panic(err)
+	}
+	err = registry.RegisterAuthenticator(&Htpasswd{}, "htpasswd")
+	if err != nil {
+		panic(err)
+	}
+}
+
+// htpasswdDummyHash is compared against for unknown users, so they can not be detected through timing.
+var htpasswdDummyHash, _ = bcrypt.GenerateFromPassword([]byte("writergo"), bcrypt.DefaultCost)
+
+// HtpasswdConfig is the configuration of the Htpasswd authenticator.
+// For convenience, the configuration may also be the plain path of the htpasswd file.
+type HtpasswdConfig struct {
+	Path      string
+	GroupFile string // optional file in the format of Apache's htgroup ("group: user1 user2")
+	Realm     string
+}
+
+// Htpasswd authenticates users through HTTP basic authentication against a htpasswd file.
+// Passwords must be hashed with bcrypt or SHA1 ({SHA}).
+type Htpasswd struct {
+	realm  string
+	users  map[string]string   // user -> hash
+	groups map[string][]string // user -> groups
+}
+
+func (h *Htpasswd) Authenticate(rw http.ResponseWriter, r *http.Request) (registry.Identity, bool) {
+	user, password, ok := r.BasicAuth()
+	if ok && h.check(user, password) {
+		return registry.Identity{User: user, Groups: h.groups[user]}, true
+	}
+	rw.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", h.realm))
+	http.Error(rw, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	return registry.Identity{}, false
+}
+
+func (h *Htpasswd) check(user, password string) bool {
+	hash, ok := h.users[user]
+	if !ok {
+		bcrypt.CompareHashAndPassword(htpasswdDummyHash, []byte(password))
+		return false
+	}
+	if strings.HasPrefix(hash, "{SHA}") {
+		sum := sha1.Sum([]byte(password))
+		expected := strings.Join([]string{"{SHA}", base64.StdEncoding.EncodeToString(sum[:])}, "")
+		return subtle.ConstantTimeCompare([]byte(hash), []byte(expected)) == 1
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+func (h *Htpasswd) LoadConfig(data []byte) error {
+	c := HtpasswdConfig{}
+	err := registry.DecodeConfig(data, &c, func(s string) { c.Path = s })
+	if err != nil {
+		return fmt.Errorf("htpasswd: %w", err)
+	}
+	if c.Path == "" {
+		return errors.New("htpasswd: no path given, set AuthenticatorConfig to the htpasswd file or to an object with 'Path'")
+	}
+	if c.Realm == "" {
+		c.Realm = "WriterGo!"
+	}
+
+	users := make(map[string]string)
+	err = readColonFile(c.Path, func(line int, user, hash string) error {
+		switch {
+		case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"), strings.HasPrefix(hash, "{SHA}"):
+		default:
+			return fmt.Errorf("line %d: unsupported hash for user '%s', only bcrypt and SHA1 are supported", line, user)
+		}
+		users[user] = hash
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("htpasswd: %w", err)
+	}
+
+	groups := make(map[string][]string)
+	if c.GroupFile != "" {
+		err = readColonFile(c.GroupFile, func(line int, group, members string) error {
+			for _, user := range strings.Fields(members) {
+				groups[user] = append(groups[user], group)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("htpasswd: %w", err)
+		}
+	}
+
+	h.realm = c.Realm
+	h.users = users
+	h.groups = groups
+	return nil
+}
+
+// readColonFile calls f for every "key:value" line of a file.
+// Empty lines and comments are skipped.
+func readColonFile(path string, f func(line int, key, value string) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("can not open '%s': %w", path, err)
+	}
+	defer file.Close()
+
+	s := bufio.NewScanner(file)
+	line := 0
+	for s.Scan() {
+		line++
+		text := strings.TrimSpace(s.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(text, ":")
+		if !ok || key == "" {
+			return fmt.Errorf("%s line %d: missing ':'", path, line)
+		}
+		err = f(line, strings.TrimSpace(key), strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%s %w", path, err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("can not read '%s': %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHtpasswd(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("bcrypt password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha1.Sum([]byte("sha password"))
+	dir := t.TempDir()
+	path := filepath.Join(dir, "htpasswd")
+	err = os.WriteFile(path, []byte(strings.Join([]string{
+		"# users",
+		strings.Join([]string{"alice:", string(bcryptHash)}, ""),
+		"",
+		strings.Join([]string{"bob:{SHA}", base64.StdEncoding.EncodeToString(sum[:])}, ""),
+	}, "\n")), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups := filepath.Join(dir, "htgroup")
+	err = os.WriteFile(groups, []byte("staff: alice bob\nadmins: alice\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &Htpasswd{}
+	c, err := json.Marshal(HtpasswdConfig{Path: path, GroupFile: groups})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = h.LoadConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		groups   string // empty if the user must be rejected
+	}{
+		{"bcrypt", "alice", "bcrypt password", "staff,admins"},
+		{"SHA1", "bob", "sha password", "staff"},
+		{"wrong bcrypt password", "alice", "sha password", ""},
+		{"wrong SHA1 password", "bob", "bcrypt password", ""},
+		{"empty password", "alice", "", ""},
+		{"unknown user", "mallory", "bcrypt password", ""},
+		{"case of user", "Alice", "bcrypt password", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.SetBasicAuth(tt.user, tt.password)
+			id, ok := h.Authenticate(rec, r)
+			if tt.groups == "" {
+				if ok || rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+					t.Errorf("got %+v (%t) with status %d, want rejection", id, ok, rec.Code)
+				}
+				return
+			}
+			if !ok || id.User != tt.user || strings.Join(id.Groups, ",") != tt.groups {
+				t.Errorf("got %+v (%t), want %s in %s", id, ok, tt.user, tt.groups)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	_, ok := h.Authenticate(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if ok || rec.Code != http.StatusUnauthorized {
+		t.Errorf("request without credentials got status %d (%t)", rec.Code, ok)
+	}
+}
+
+func TestHtpasswdRejectsUnsupportedHash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	err := os.WriteFile(path, []byte("alice:$apr1$salt$hash\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = (&Htpasswd{}).LoadConfig([]byte(path))
+	if err == nil {
+		t.Error("accepted unsupported hash")
+	}
+}
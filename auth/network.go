@@ -0,0 +1,69 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Networks is a list of IP networks, e.g. of trusted proxies.
+type Networks []*net.IPNet
+
+// ParseNetworks parses a list of IP addresses and CIDR ranges.
+func ParseNetworks(list []string) (Networks, error) {
+	n := make(Networks, 0, len(list))
+	for _, p := range list {
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address '%s'", p)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				bits = 8 * net.IPv4len
+			}
+			n = append(n, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network '%s': %w", p, err)
+		}
+		n = append(n, network)
+	}
+	return n, nil
+}
+
+// Contains reports whether the address is in one of the networks.
+// The address may contain a port (e.g. the remote address of a request).
+func (n Networks) Contains(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for i := range n {
+		if n[i].Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+
+	"github.com/Top-Ranger/writergo/registry"
+)
+
+func init() {
+	err := registry.RegisterAuthenticator(&None{}, "")
+	if err != nil {
+		panic(err)
+	}
+	err = registry.RegisterAuthenticator(&None{}, "None")
+	if err != nil {
+		panic(err)
+	}
+	err = registry.RegisterAuthenticator(&None{}, "none")
+	if err != nil {
+		panic(err)
+	}
+}
+
+// None allows everyone to use WriterGo! without authentication.
+// All users are anonymous.
+type None struct{}
+
+func (*None) Authenticate(rw http.ResponseWriter, r *http.Request) (registry.Identity, bool) {
+	return registry.Identity{}, true
+}
+
+func (*None) LoadConfig(data []byte) error {
+	if len(bytes.TrimSpace(data)) != 0 {
+		log.Println("none: AuthenticatorConfig is ignored, since no authentication is used")
+	}
+	return nil
+}
@@ -0,0 +1,545 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Top-Ranger/writergo/registry"
+)
+
+func init() {
+	err := registry.RegisterAuthenticator(&OIDC{}, "OIDC")
+	if err != nil {
+		panic(err)
+	}
+	err = registry.RegisterAuthenticator(&OIDC{}, "oidc")
+	if err != nil {
+		panic(err)
+	}
+}
+
+const (
+	oidcSessionCookie = "writergo_session"
+	oidcLoginCookie   = "writergo_login"
+	oidcLoginTimeout  = 10 * time.Minute
+	oidcClockSkew     = time.Minute
+	oidcKeyRefresh    = time.Minute
+)
+
+// OIDCConfig is the configuration of the OIDC authenticator.
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string   // callback URL of WriterGo!, e.g. https://writer.example.com/auth/callback
+	Scopes       []string // defaults to openid, profile and email
+	UserClaim    string   // defaults to sub
+	NameClaim    string   // defaults to name
+	GroupsClaim  string   // defaults to groups
+	CookieSecret string   // secret to sign the session cookies, must be shared by all instances
+	SessionHours int      // defaults to 8
+}
+
+// OIDC authenticates users through OpenID Connect using the authorisation code flow.
+// Authenticated users get a signed session cookie, so the identity provider is only contacted on login.
+// ID tokens signed with RS256 or ES256 are supported.
+type OIDC struct {
+	c            OIDCConfig
+	callbackPath string
+	cookiePath   string
+	secure       bool
+	secret       []byte
+	client       *http.Client
+
+	authURL  string
+	tokenURL string
+	jwksURL  string
+
+	keysL       sync.Mutex
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+// oidcSession is the content of the session cookie.
+type oidcSession struct {
+	Identity registry.Identity
+	Expires  int64
+}
+
+// oidcLogin is the content of the cookie tracking a running login.
+type oidcLogin struct {
+	State   string
+	Nonce   string
+	Target  string
+	Expires int64
+}
+
+func (o *OIDC) Authenticate(rw http.ResponseWriter, r *http.Request) (registry.Identity, bool) {
+	if r.URL.Path == o.callbackPath {
+		o.callback(rw, r)
+		return registry.Identity{}, false
+	}
+
+	var s oidcSession
+	if o.readCookie(r, oidcSessionCookie, &s) && time.Now().Unix() < s.Expires {
+		return s.Identity, true
+	}
+
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		// Websockets can not follow the login redirect
+		http.Error(rw, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return registry.Identity{}, false
+	}
+	o.login(rw, r)
+	return registry.Identity{}, false
+}
+
+// login redirects the user to the identity provider.
+func (o *OIDC) login(rw http.ResponseWriter, r *http.Request) {
+	l := oidcLogin{
+		State:   randomToken(),
+		Nonce:   randomToken(),
+		Target:  r.URL.RequestURI(),
+		Expires: time.Now().Add(oidcLoginTimeout).Unix(),
+	}
+	o.writeCookie(rw, oidcLoginCookie, l, oidcLoginTimeout)
+
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", o.c.ClientID)
+	q.Set("redirect_uri", o.c.RedirectURL)
+	q.Set("scope", strings.Join(o.c.Scopes, " "))
+	q.Set("state", l.State)
+	q.Set("nonce", l.Nonce)
+	target := o.authURL
+	if strings.Contains(target, "?") {
+		target = strings.Join([]string{target, "&", q.Encode()}, "")
+	} else {
+		target = strings.Join([]string{target, "?", q.Encode()}, "")
+	}
+	http.Redirect(rw, r, target, http.StatusFound)
+}
+
+// callback finishes the login after the identity provider redirected the user back.
+func (o *OIDC) callback(rw http.ResponseWriter, r *http.Request) {
+	var l oidcLogin
+	if !o.readCookie(r, oidcLoginCookie, &l) || time.Now().Unix() > l.Expires {
+		http.Error(rw, "Login expired, please try again", http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		log.Printf("oidc: login failed: %s (%s)", e, q.Get("error_description"))
+		http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	if !hmac.Equal([]byte(q.Get("state")), []byte(l.State)) {
+		http.Error(rw, "Invalid login state", http.StatusBadRequest)
+		return
+	}
+
+	rawToken, err := o.exchange(q.Get("code"))
+	if err != nil {
+		log.Println("oidc: can not exchange code:", err)
+		http.Error(rw, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+	claims, err := o.verify(rawToken, l.Nonce)
+	if err != nil {
+		log.Println("oidc: invalid ID token:", err)
+		http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	id := registry.Identity{}
+	id.User, _ = claims[o.c.UserClaim].(string)
+	id.Name, _ = claims[o.c.NameClaim].(string)
+	if groups, ok := claims[o.c.GroupsClaim].([]interface{}); ok {
+		for i := range groups {
+			if g, ok := groups[i].(string); ok {
+				id.Groups = append(id.Groups, g)
+			}
+		}
+	}
+	if id.User == "" {
+		log.Printf("oidc: ID token has no claim '%s'", o.c.UserClaim)
+		http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	d := time.Duration(o.c.SessionHours) * time.Hour
+	o.writeCookie(rw, oidcSessionCookie, oidcSession{Identity: id, Expires: time.Now().Add(d).Unix()}, d)
+	o.writeCookie(rw, oidcLoginCookie, nil, -1)
+
+	target := l.Target
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") {
+		// Only redirect inside of WriterGo!
+		target = o.cookiePath
+	}
+	http.Redirect(rw, r, target, http.StatusFound)
+}
+
+// exchange exchanges the authorisation code for an ID token.
+func (o *OIDC) exchange(code string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", o.c.RedirectURL)
+	req, err := http.NewRequest(http.MethodPost, o.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(o.c.ClientID), url.QueryEscape(o.c.ClientSecret))
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("token endpoint returned %s: %s", resp.Status, string(b))
+	}
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&token)
+	if err != nil {
+		return "", fmt.Errorf("can not parse token response: %w", err)
+	}
+	if token.IDToken == "" {
+		return "", errors.New("no ID token in response")
+	}
+	return token.IDToken, nil
+}
+
+// verify checks the signature and the claims of an ID token and returns the claims.
+func (o *OIDC) verify(token, nonce string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	err := decodeSegment(parts[0], &header)
+	if err != nil {
+		return nil, fmt.Errorf("can not parse header: %w", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("can not decode signature: %w", err)
+	}
+	key, err := o.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256([]byte(strings.Join(parts[:2], ".")))
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if header.Alg != "RS256" {
+			return nil, fmt.Errorf("algorithm '%s' does not match RSA key", header.Alg)
+		}
+		err = rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig)
+		if err != nil {
+			return nil, errors.New("invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		if header.Alg != "ES256" || len(sig) != 64 {
+			return nil, fmt.Errorf("algorithm '%s' does not match EC key", header.Alg)
+		}
+		if !ecdsa.Verify(k, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+			return nil, errors.New("invalid signature")
+		}
+	default:
+		return nil, errors.New("unsupported key")
+	}
+
+	var claims map[string]interface{}
+	err = decodeSegment(parts[1], &claims)
+	if err != nil {
+		return nil, fmt.Errorf("can not parse claims: %w", err)
+	}
+	if iss, _ := claims["iss"].(string); iss != o.c.Issuer {
+		return nil, fmt.Errorf("wrong issuer '%s'", iss)
+	}
+	audience := false
+	switch aud := claims["aud"].(type) {
+	case string:
+		audience = aud == o.c.ClientID
+	case []interface{}:
+		for i := range aud {
+			if aud[i] == o.c.ClientID {
+				audience = true
+			}
+		}
+	}
+	if !audience {
+		return nil, errors.New("token not issued for this client")
+	}
+	exp, _ := claims["exp"].(float64)
+	if time.Now().Add(-oidcClockSkew).After(time.Unix(int64(exp), 0)) {
+		return nil, errors.New("token expired")
+	}
+	if n, _ := claims["nonce"].(string); !hmac.Equal([]byte(n), []byte(nonce)) {
+		return nil, errors.New("wrong nonce")
+	}
+	return claims, nil
+}
+
+// key returns the signing key of the identity provider with the given key ID.
+// Unknown keys cause the keys to be fetched again, since the identity provider might have rotated them.
+func (o *OIDC) key(kid string) (crypto.PublicKey, error) {
+	o.keysL.Lock()
+	defer o.keysL.Unlock()
+
+	if k, ok := o.keys[kid]; ok {
+		return k, nil
+	}
+	if time.Since(o.keysFetched) < oidcKeyRefresh {
+		return nil, fmt.Errorf("unknown key '%s'", kid)
+	}
+	keys, err := o.fetchKeys()
+	o.keysFetched = time.Now()
+	if err != nil {
+		return nil, fmt.Errorf("can not fetch keys: %w", err)
+	}
+	o.keys = keys
+	if k, ok := o.keys[kid]; ok {
+		return k, nil
+	}
+	if len(o.keys) == 1 && kid == "" {
+		for _, k := range o.keys {
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown key '%s'", kid)
+}
+
+// fetchKeys loads the signing keys of the identity provider.
+func (o *OIDC) fetchKeys() (map[string]crypto.PublicKey, error) {
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	err := o.getJSON(o.jwksURL, &jwks)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+			e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+			if err1 != nil || err2 != nil || len(e) > 4 {
+				log.Printf("oidc: skipping invalid RSA key '%s'", k.Kid)
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			x, err1 := base64.RawURLEncoding.DecodeString(k.X)
+			y, err2 := base64.RawURLEncoding.DecodeString(k.Y)
+			if k.Crv != "P-256" || err1 != nil || err2 != nil {
+				log.Printf("oidc: skipping unsupported EC key '%s'", k.Kid)
+				continue
+			}
+			pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+			if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+				log.Printf("oidc: skipping invalid EC key '%s'", k.Kid)
+				continue
+			}
+			keys[k.Kid] = pub
+		}
+	}
+	return keys, nil
+}
+
+func (o *OIDC) getJSON(u string, v interface{}) error {
+	resp, err := o.client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", u, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// writeCookie stores a signed value in a cookie. A negative duration removes the cookie.
+func (o *OIDC) writeCookie(rw http.ResponseWriter, name string, v interface{}, d time.Duration) {
+	value := ""
+	if d >= 0 {
+		b, err := json.Marshal(v)
+		if err != nil {
+			log.Println("oidc: can not encode cookie:", err)
+			return
+		}
+		payload := base64.RawURLEncoding.EncodeToString(b)
+		value = strings.Join([]string{payload, o.sign(payload)}, ".")
+	}
+	http.SetCookie(rw, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     o.cookiePath,
+		MaxAge:   int(d.Seconds()),
+		Secure:   o.secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// readCookie reads a signed value from a cookie.
+func (o *OIDC) readCookie(r *http.Request, name string, v interface{}) bool {
+	c, err := r.Cookie(name)
+	if err != nil {
+		return false
+	}
+	payload, sig, ok := strings.Cut(c.Value, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(o.sign(payload))) {
+		return false
+	}
+	return decodeSegment(payload, v) == nil
+}
+
+func (o *OIDC) sign(payload string) string {
+	m := hmac.New(sha256.New, o.secret)
+	m.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+func decodeSegment(s string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// SetServerPath scopes the cookies to the path WriterGo! is served under.
+func (o *OIDC) SetServerPath(path string) {
+	o.cookiePath = strings.Join([]string{path, "/"}, "")
+}
+
+func (o *OIDC) LoadConfig(data []byte) error {
+	c := OIDCConfig{}
+	err := registry.DecodeConfig(data, &c, func(s string) {})
+	if err != nil {
+		return fmt.Errorf("oidc: %w", err)
+	}
+	if c.Issuer == "" || c.ClientID == "" || c.RedirectURL == "" {
+		return errors.New("oidc: Issuer, ClientID and RedirectURL must be set in AuthenticatorConfig")
+	}
+	redirect, err := url.Parse(c.RedirectURL)
+	if err != nil || (redirect.Scheme != "http" && redirect.Scheme != "https") || redirect.Path == "" {
+		return fmt.Errorf("oidc: RedirectURL '%s' must be an absolute http or https URL", c.RedirectURL)
+	}
+	if o.cookiePath == "" {
+		o.cookiePath = "/"
+	}
+	if !strings.HasPrefix(redirect.Path, o.cookiePath) {
+		return fmt.Errorf("oidc: path of RedirectURL '%s' must be below ServerPath", c.RedirectURL)
+	}
+	if len(c.Scopes) == 0 {
+		c.Scopes = []string{"openid", "profile", "email"}
+	}
+	if c.UserClaim == "" {
+		c.UserClaim = "sub"
+	}
+	if c.NameClaim == "" {
+		c.NameClaim = "name"
+	}
+	if c.GroupsClaim == "" {
+		c.GroupsClaim = "groups"
+	}
+	if c.SessionHours <= 0 {
+		c.SessionHours = 8
+	}
+
+	o.c = c
+	o.callbackPath = redirect.Path
+	o.secure = redirect.Scheme == "https"
+	o.client = &http.Client{Timeout: 10 * time.Second}
+	o.keys = make(map[string]crypto.PublicKey)
+	if c.CookieSecret != "" {
+		o.secret = []byte(c.CookieSecret)
+	} else {
+		log.Println("oidc: no CookieSecret set, sessions are lost on restart and are not shared between instances")
+		o.secret = make([]byte, 32)
+		_, err = rand.Read(o.secret)
+		if err != nil {
+			return fmt.Errorf("oidc: can not create cookie secret: %w", err)
+		}
+	}
+
+	var discovery struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JwksURI               string `json:"jwks_uri"`
+	}
+	err = o.getJSON(strings.Join([]string{strings.TrimSuffix(c.Issuer, "/"), "/.well-known/openid-configuration"}, ""), &discovery)
+	if err != nil {
+		return fmt.Errorf("oidc: can not discover identity provider: %w", err)
+	}
+	if discovery.Issuer != c.Issuer {
+		return fmt.Errorf("oidc: identity provider reports issuer '%s' instead of '%s'", discovery.Issuer, c.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JwksURI == "" {
+		return errors.New("oidc: identity provider does not provide all required endpoints")
+	}
+	o.authURL = discovery.AuthorizationEndpoint
+	o.tokenURL = discovery.TokenEndpoint
+	o.jwksURL = discovery.JwksURI
+	return nil
+}
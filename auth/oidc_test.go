@@ -0,0 +1,262 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testIdP is an identity provider issuing ID tokens for a single code.
+type testIdP struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	l     sync.Mutex
+	nonce string // nonce put into the next ID token
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &testIdP{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(rw http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(rw).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": strings.Join([]string{idp.URL, "/authorize"}, ""),
+			"token_endpoint":         strings.Join([]string{idp.URL, "/token"}, ""),
+			"jwks_uri":               strings.Join([]string{idp.URL, "/keys"}, ""),
+		})
+	})
+	mux.HandleFunc("/keys", func(rw http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(rw).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(rw http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+		if r.Method != http.MethodPost || r.PostFormValue("code") != "code" || user != "writergo" || password != "secret" {
+			http.Error(rw, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		idp.l.Lock()
+		nonce := idp.nonce
+		idp.l.Unlock()
+		json.NewEncoder(rw).Encode(map[string]string{"id_token": idp.token(t, map[string]interface{}{
+			"iss":    idp.URL,
+			"aud":    "writergo",
+			"exp":    time.Now().Add(time.Minute).Unix(),
+			"sub":    "alice",
+			"name":   "Alice",
+			"groups": []string{"staff"},
+			"nonce":  nonce,
+		})})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+// token returns an ID token with the given claims signed by the identity provider.
+func (idp *testIdP) token(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test"})
+	payload, _ := json.Marshal(claims)
+	signed := strings.Join([]string{base64.RawURLEncoding.EncodeToString(header), base64.RawURLEncoding.EncodeToString(payload)}, ".")
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Join([]string{signed, base64.RawURLEncoding.EncodeToString(sig)}, ".")
+}
+
+func (idp *testIdP) setNonce(n string) {
+	idp.l.Lock()
+	defer idp.l.Unlock()
+	idp.nonce = n
+}
+
+// testOIDC returns an OIDC authenticator served under /writer using idp.
+func testOIDC(t *testing.T, idp *testIdP) *OIDC {
+	t.Helper()
+	o := &OIDC{}
+	o.SetServerPath("/writer")
+	err := o.LoadConfig([]byte(fmt.Sprintf(`{"Issuer": "%s", "ClientID": "writergo", "ClientSecret": "secret", "RedirectURL": "https://writer.example.com/writer/auth/callback"}`, idp.URL)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+// startLogin opens a document without session and returns the cookies and the parameters of the redirect to the identity provider.
+func startLogin(t *testing.T, o *OIDC) ([]*http.Cookie, url.Values) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	_, ok := o.Authenticate(rec, httptest.NewRequest(http.MethodGet, "/writer/doc", nil))
+	if ok {
+		t.Fatal("authenticated without session")
+	}
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login returned %d, want %d", rec.Code, http.StatusFound)
+	}
+	target, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.Path != "/authorize" {
+		t.Fatalf("login redirects to %s", target)
+	}
+	return rec.Result().Cookies(), target.Query()
+}
+
+// finishLogin calls the callback like the browser returning from the identity provider.
+func finishLogin(o *OIDC, cookies []*http.Cookie, state, code string) *httptest.ResponseRecorder {
+	q := url.Values{}
+	q.Set("state", state)
+	q.Set("code", code)
+	r := httptest.NewRequest(http.MethodGet, strings.Join([]string{"/writer/auth/callback?", q.Encode()}, ""), nil)
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	o.Authenticate(rec, r)
+	return rec
+}
+
+func TestOIDCLogin(t *testing.T) {
+	idp := newTestIdP(t)
+	o := testOIDC(t, idp)
+
+	cookies, q := startLogin(t, o)
+	if q.Get("client_id") != "writergo" || q.Get("redirect_uri") != "https://writer.example.com/writer/auth/callback" || q.Get("state") == "" || q.Get("nonce") == "" {
+		t.Fatalf("invalid authorisation request %v", q)
+	}
+	for _, c := range cookies {
+		if c.Path != "/writer/" {
+			t.Errorf("cookie %s has path %s, want /writer/", c.Name, c.Path)
+		}
+	}
+
+	idp.setNonce(q.Get("nonce"))
+	rec := finishLogin(o, cookies, q.Get("state"), "code")
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/writer/doc" {
+		t.Fatalf("callback returned %d to '%s', want %d to /writer/doc", rec.Code, rec.Header().Get("Location"), http.StatusFound)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/writer/doc", nil)
+	for _, c := range rec.Result().Cookies() {
+		if c.Path != "/writer/" {
+			t.Errorf("cookie %s has path %s, want /writer/", c.Name, c.Path)
+		}
+		if c.Name == oidcSessionCookie {
+			r.AddCookie(c)
+		}
+	}
+	id, ok := o.Authenticate(httptest.NewRecorder(), r)
+	if !ok {
+		t.Fatal("not authenticated with session cookie")
+	}
+	if id.User != "alice" || id.Name != "Alice" || len(id.Groups) != 1 || id.Groups[0] != "staff" {
+		t.Errorf("wrong identity %+v", id)
+	}
+}
+
+func TestOIDCCallbackRejects(t *testing.T) {
+	idp := newTestIdP(t)
+	o := testOIDC(t, idp)
+
+	tests := []struct {
+		name  string
+		state func(string) string
+		nonce func(string) string
+		code  string
+		want  int
+	}{
+		{"wrong state", func(s string) string { return "other" }, func(n string) string { return n }, "code", http.StatusBadRequest},
+		{"wrong nonce", func(s string) string { return s }, func(n string) string { return "other" }, "code", http.StatusForbidden},
+		{"missing nonce", func(s string) string { return s }, func(n string) string { return "" }, "code", http.StatusForbidden},
+		{"invalid code", func(s string) string { return s }, func(n string) string { return n }, "wrong", http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cookies, q := startLogin(t, o)
+			idp.setNonce(tt.nonce(q.Get("nonce")))
+			rec := finishLogin(o, cookies, tt.state(q.Get("state")), tt.code)
+			if rec.Code != tt.want {
+				t.Errorf("callback returned %d, want %d", rec.Code, tt.want)
+			}
+			for _, c := range rec.Result().Cookies() {
+				if c.Name == oidcSessionCookie {
+					t.Error("session cookie set")
+				}
+			}
+		})
+	}
+
+	t.Run("without login cookie", func(t *testing.T) {
+		_, q := startLogin(t, o)
+		idp.setNonce(q.Get("nonce"))
+		rec := finishLogin(o, nil, q.Get("state"), "code")
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("callback returned %d, want %d", rec.Code, http.StatusBadRequest)
+		}
+	})
+}
+
+func TestOIDCDiscovery(t *testing.T) {
+	idp := newTestIdP(t)
+
+	o := &OIDC{}
+	err := o.LoadConfig([]byte(fmt.Sprintf(`{"Issuer": "%s/", "ClientID": "writergo", "RedirectURL": "https://writer.example.com/auth/callback"}`, idp.URL)))
+	if err == nil {
+		t.Error("accepted identity provider reporting another issuer")
+	}
+
+	o = testOIDC(t, idp)
+	if o.authURL != strings.Join([]string{idp.URL, "/authorize"}, "") || o.tokenURL != strings.Join([]string{idp.URL, "/token"}, "") || o.jwksURL != strings.Join([]string{idp.URL, "/keys"}, "") {
+		t.Errorf("wrong endpoints %s, %s, %s", o.authURL, o.tokenURL, o.jwksURL)
+	}
+
+	o = &OIDC{}
+	o.SetServerPath("/writer")
+	err = o.LoadConfig([]byte(fmt.Sprintf(`{"Issuer": "%s", "ClientID": "writergo", "RedirectURL": "https://writer.example.com/auth/callback"}`, idp.URL)))
+	if err == nil {
+		t.Error("accepted RedirectURL outside of ServerPath")
+	}
+}
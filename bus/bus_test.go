@@ -0,0 +1,220 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bus
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Top-Ranger/writergo/registry"
+)
+
+// receive returns a handler sending all messages to the returned channel.
+func receive() (func(data []byte), chan string) {
+	c := make(chan string, 100)
+	return func(data []byte) { c <- string(data) }, c
+}
+
+// expectMessages checks that c receives want in order and nothing else.
+func expectMessages(t *testing.T, c chan string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		select {
+		case got := <-c:
+			if got != w {
+				t.Fatalf("received '%s', want '%s'", got, w)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("did not receive '%s'", w)
+		}
+	}
+	select {
+	case got := <-c:
+		t.Fatalf("received unexpected '%s'", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// testBus runs the tests every registry.Bus must pass.
+// Both busses must be connected to each other, they might be the same.
+func testBus(t *testing.T, a, b registry.Bus) {
+	t.Run("publish", func(t *testing.T) {
+		h1, c1 := receive()
+		h2, c2 := receive()
+		hOther, cOther := receive()
+		for _, s := range []struct {
+			bus   registry.Bus
+			topic string
+			h     func([]byte)
+		}{{a, "writer.test", h1}, {b, "writer.test", h2}, {b, "writer.other", hOther}} {
+			sub, err := s.bus.Subscribe(s.topic, s.h)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { sub.Unsubscribe() })
+		}
+		syncBus(t, a, b)
+
+		want := make([]string, 50)
+		for i := range want {
+			want[i] = fmt.Sprint(i)
+			err := a.Publish("writer.test", []byte(want[i]))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		expectMessages(t, c1, want...)
+		expectMessages(t, c2, want...)
+		expectMessages(t, cOther)
+	})
+
+	t.Run("unsubscribe", func(t *testing.T) {
+		h, c := receive()
+		sub, err := b.Subscribe("writer.unsubscribe", h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		syncBus(t, a, b)
+		err = a.Publish("writer.unsubscribe", []byte("before"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectMessages(t, c, "before")
+
+		err = sub.Unsubscribe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		syncBus(t, a, b)
+		err = a.Publish("writer.unsubscribe", []byte("after"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectMessages(t, c)
+	})
+
+	t.Run("publish from handler", func(t *testing.T) {
+		h, c := receive()
+		sub, err := a.Subscribe("writer.answer", h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { sub.Unsubscribe() })
+		sub, err = b.Subscribe("writer.question", func(data []byte) {
+			err := b.Publish("writer.answer", data)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { sub.Unsubscribe() })
+		syncBus(t, a, b)
+
+		err = a.Publish("writer.question", []byte("42"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectMessages(t, c, "42")
+	})
+}
+
+// syncBus waits until subscriptions of b are known to a.
+func syncBus(t *testing.T, a, b registry.Bus) {
+	t.Helper()
+	h, c := receive()
+	sub, err := b.Subscribe("writer.sync", h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+	deadline := time.After(5 * time.Second)
+	for {
+		// Messages published before the subscription reached the other side are lost, so retry
+		err = a.Publish("writer.sync", []byte("sync"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-c:
+			return
+		case <-time.After(100 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("busses are not connected")
+		}
+	}
+}
+
+func TestLocal(t *testing.T) {
+	l := &Local{}
+	t.Cleanup(l.Close)
+	err := l.LoadConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBus(t, l, l)
+}
+
+func TestLocalClose(t *testing.T) {
+	l := &Local{}
+	h, c := receive()
+	_, err := l.Subscribe("writer.close", h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	done := make(chan struct{})
+	go func() {
+		l.Publish("writer.close", []byte("closed"))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Publish blocks after Close")
+	}
+	expectMessages(t, c)
+}
+
+func TestLocalSubscribers(t *testing.T) {
+	l := &Local{}
+	t.Cleanup(l.Close)
+	if n := l.Subscribers("writer.count"); n != 0 {
+		t.Fatalf("got %d subscribers, want 0", n)
+	}
+	h, _ := receive()
+	subs := make([]registry.Subscription, 2)
+	for i := range subs {
+		var err error
+		subs[i], err = l.Subscribe("writer.count", h)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := l.Subscribers("writer.count"); n != 2 {
+		t.Fatalf("got %d subscribers, want 2", n)
+	}
+	err := subs[0].Unsubscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := l.Subscribers("writer.count"); n != 1 {
+		t.Fatalf("got %d subscribers, want 1", n)
+	}
+}
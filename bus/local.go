@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bus
+
+import (
+	"sync"
+
+	"github.com/Top-Ranger/writergo/registry"
+)
+
+func init() {
+	err := registry.RegisterBus(&Local{}, "")
+	if err != nil {
+		panic(err)
+	}
+	err = registry.RegisterBus(&Local{}, "Local")
+	if err != nil {
+		panic(err)
+	}
+	err = registry.RegisterBus(&Local{}, "local")
+	if err != nil {
+		panic(err)
+	}
+}
+
+// localQueueSize is the number of messages buffered for each subscription.
+const localQueueSize = 100
+
+// Local is a message bus which only delivers messages inside of the current process.
+// It is the default if only a single instance of WriterGo! is running.
+type Local struct {
+	l           sync.Mutex
+	subscribers map[string]map[*localSubscription]bool
+}
+
+type localSubscription struct {
+	bus   *Local
+	topic string
+	queue chan []byte
+	done  chan struct{}
+	once  sync.Once
+}
+
+func (l *Local) Publish(topic string, data []byte) error {
+	l.l.Lock()
+	subscribers := make([]*localSubscription, 0, len(l.subscribers[topic]))
+	for s := range l.subscribers[topic] {
+		subscribers = append(subscribers, s)
+	}
+	l.l.Unlock()
+
+	// Do not hold the lock while delivering, handlers might publish themselves
+	for _, s := range subscribers {
+		select {
+		case s.queue <- data:
+		case <-s.done:
+		}
+	}
+	return nil
+}
+
+func (l *Local) Subscribe(topic string, handler func(data []byte)) (registry.Subscription, error) {
+	l.l.Lock()
+	defer l.l.Unlock()
+
+	if l.subscribers == nil {
+		l.subscribers = make(map[string]map[*localSubscription]bool)
+	}
+	if l.subscribers[topic] == nil {
+		l.subscribers[topic] = make(map[*localSubscription]bool)
+	}
+
+	s := &localSubscription{
+		bus:   l,
+		topic: topic,
+		queue: make(chan []byte, localQueueSize),
+		done:  make(chan struct{}),
+	}
+	l.subscribers[topic][s] = true
+
+	go func() {
+		for {
+			select {
+			case data := <-s.queue:
+				handler(data)
+			case <-s.done:
+				return
+			}
+		}
+	}()
+
+	return s, nil
+}
+
+func (l *Local) Subscribers(topic string) int {
+	l.l.Lock()
+	defer l.l.Unlock()
+	return len(l.subscribers[topic])
+}
+
+func (l *Local) LoadConfig(data []byte) error {
+	return nil
+}
+
+func (l *Local) Close() {
+	l.l.Lock()
+	defer l.l.Unlock()
+
+	for topic := range l.subscribers {
+		for s := range l.subscribers[topic] {
+			s.once.Do(func() { close(s.done) })
+		}
+	}
+	l.subscribers = nil
+}
+
+func (s *localSubscription) Unsubscribe() error {
+	s.bus.l.Lock()
+	defer s.bus.l.Unlock()
+
+	s.once.Do(func() { close(s.done) })
+	delete(s.bus.subscribers[s.topic], s)
+	if len(s.bus.subscribers[s.topic]) == 0 {
+		delete(s.bus.subscribers, s.topic)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+//go:build nats
+
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bus
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Top-Ranger/writergo/registry"
+	"github.com/nats-io/nats.go"
+)
+
+func init() {
+	err := registry.RegisterBus(&NATS{}, "NATS")
+	if err != nil {
+		panic(err)
+	}
+	err = registry.RegisterBus(&NATS{}, "nats")
+	if err != nil {
+		panic(err)
+	}
+}
+
+// ErrNATSNotConfigured is returned when the bus is used before it is configured
+var ErrNATSNotConfigured = errors.New("nats: usage before configuration is used")
+
+// NATSConfig is the configuration of the NATS bus.
+// For backwards compatibility, the configuration may also be the plain URL.
+type NATSConfig struct {
+	URL string
+}
+
+// NATS is a message bus backed by a NATS server.
+type NATS struct {
+	conn *nats.Conn
+}
+
+func (n *NATS) Publish(topic string, data []byte) error {
+	if n.conn == nil {
+		return ErrNATSNotConfigured
+	}
+	return n.conn.Publish(topic, data)
+}
+
+func (n *NATS) Subscribe(topic string, handler func(data []byte)) (registry.Subscription, error) {
+	if n.conn == nil {
+		return nil, ErrNATSNotConfigured
+	}
+	return n.conn.Subscribe(topic, func(m *nats.Msg) {
+		handler(m.Data)
+	})
+}
+
+func (n *NATS) LoadConfig(data []byte) error {
+	c := NATSConfig{}
+	err := registry.DecodeConfig(data, &c, func(s string) { c.URL = s })
+	if err != nil {
+		return fmt.Errorf("nats: %w", err)
+	}
+	if c.URL == "" {
+		c.URL = nats.DefaultURL
+	}
+	conn, err := nats.Connect(c.URL, nats.Name("WriterGo!"), nats.MaxReconnects(-1))
+	if err != nil {
+		// The URL is not logged since it might contain credentials
+		return fmt.Errorf("nats: can not connect: %w", err)
+	}
+	n.conn = conn
+	return nil
+}
+
+func (n *NATS) Close() {
+	if n.conn == nil {
+		return
+	}
+	err := n.conn.Drain()
+	if err != nil {
+		n.conn.Close()
+	}
+}
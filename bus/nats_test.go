@@ -0,0 +1,78 @@
+//go:build nats
+
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bus
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+// testNATSServer starts an embedded NATS server and returns its URL.
+func testNATSServer(t *testing.T) string {
+	t.Helper()
+	s, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: server.RANDOM_PORT, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Start()
+	t.Cleanup(s.Shutdown)
+	if !s.ReadyForConnections(10 * time.Second) {
+		t.Fatal("NATS server not ready")
+	}
+	return s.ClientURL()
+}
+
+func TestNATS(t *testing.T) {
+	u := testNATSServer(t)
+
+	a := &NATS{}
+	err := a.LoadConfig([]byte(u))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(a.Close)
+	b := &NATS{}
+	c, err := json.Marshal(NATSConfig{URL: u})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.LoadConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(b.Close)
+
+	testBus(t, a, b)
+}
+
+func TestNATSNotConfigured(t *testing.T) {
+	n := &NATS{}
+	err := n.Publish("writer.test", nil)
+	if !errors.Is(err, ErrNATSNotConfigured) {
+		t.Errorf("Publish returned %v, want %v", err, ErrNATSNotConfigured)
+	}
+	_, err = n.Subscribe("writer.test", func([]byte) {})
+	if !errors.Is(err, ErrNATSNotConfigured) {
+		t.Errorf("Subscribe returned %v, want %v", err, ErrNATSNotConfigured)
+	}
+	n.Close()
+}
@@ -0,0 +1,185 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"strings"
+
+	"github.com/Top-Ranger/writergo/registry"
+)
+
+// Types of messages exchanged between instances through the message bus.
+const (
+	busState       = "state"
+	busStopWrite   = "stop_write"
+	busActive      = "active"
+	busUsers       = "users"
+	busSyncRequest = "sync_request"
+	busSync        = "sync"
+	busACL         = "acl"
+)
+
+// busMessage represents a message about a writer exchanged with other instances.
+type busMessage struct {
+	Type     string
+	Instance string
+	Data     string `json:",omitempty"`
+	Revision int    `json:",omitempty"`
+	Author   string `json:",omitempty"`
+	Active   string `json:",omitempty"`
+	Users    int    `json:",omitempty"`
+}
+
+var messageBus registry.Bus
+
+// busInstance identifies this instance on the message bus.
+var busInstance = RandomString()
+
+// busTopic returns the topic of the message bus used for the writer.
+func busTopic(key string) string {
+	return strings.Join([]string{"writergo", hex.EncodeToString([]byte(key))}, ".")
+}
+
+// busQualify returns a connection key which is unique across all instances.
+// Keys of other instances are already qualified and returned unchanged.
+func busQualify(key string) string {
+	if key == "" || strings.Contains(key, ":") {
+		return key
+	}
+	return strings.Join([]string{busInstance, key}, ":")
+}
+
+// busLocal returns the local connection key of a qualified key.
+// The bool indicates whether the key belongs to this instance.
+func busLocal(qualified string) (string, bool) {
+	if qualified == "" {
+		return "", true
+	}
+	instance, key, ok := strings.Cut(qualified, ":")
+	if !ok || instance != busInstance {
+		return qualified, false
+	}
+	return key, true
+}
+
+// publish sends a message about the writer to all other instances.
+func (w *writer) publish(m busMessage) {
+	topic := busTopic(w.Key)
+	if l, ok := messageBus.(registry.LocalBus); ok && l.Subscribers(topic) <= 1 {
+		// Only the writer itself would receive the message
+		return
+	}
+	m.Instance = busInstance
+	b, err := json.Marshal(&m)
+	if err != nil {
+		log.Println(w.Key, "can not encode bus message:", err)
+		return
+	}
+	err = messageBus.Publish(topic, b)
+	if err != nil {
+		log.Println(w.Key, "can not publish bus message:", err)
+	}
+}
+
+// handleBusMessage applies a message of another instance to the writer.
+func (w *writer) handleBusMessage(b []byte) {
+	var m busMessage
+	err := json.Unmarshal(b, &m)
+	if err != nil {
+		log.Println(w.Key, "can not parse bus message:", err)
+		return
+	}
+	if m.Instance == busInstance {
+		return
+	}
+
+	w.l.Lock()
+	defer w.l.Unlock()
+
+	switch m.Type {
+	case busState:
+		w.applyRemoteState(m)
+	case busStopWrite:
+		if w.connections[w.active] != nil {
+			w.send(w.active, command{Comm: commandStopWrite})
+		}
+	case busActive:
+		w.applyRemoteActive(m.Active)
+	case busUsers:
+		w.remoteUsers[m.Instance] = m.Users
+		w.broadcastUsers()
+	case busSyncRequest:
+		w.currentL.Lock()
+		reply := busMessage{Type: busSync, Data: w.current, Revision: w.revision, Author: w.revisionAuthor, Active: busQualify(w.active), Users: len(w.connections)}
+		w.currentL.Unlock()
+		w.publish(reply)
+	case busSync:
+		w.applyRemoteState(m)
+		if w.active == "" {
+			w.applyRemoteActive(m.Active)
+		}
+		w.remoteUsers[m.Instance] = m.Users
+		w.broadcastUsers()
+	case busACL:
+		var a documentACL
+		err := json.Unmarshal([]byte(m.Data), &a)
+		if err != nil {
+			log.Println(w.Key, "can not parse remote ACL:", err)
+			return
+		}
+		w.applyACL(a)
+	default:
+		log.Println(w.Key, "unknown bus message:", m.Type)
+	}
+}
+
+// applyRemoteState stores a state written on another instance if it is newer than the current state.
+// Caller must hold w.l.
+func (w *writer) applyRemoteState(m busMessage) {
+	w.currentL.Lock()
+	if m.Revision <= w.revision {
+		w.currentL.Unlock()
+		if m.Type == busState {
+			log.Println(w.Key, "ignoring outdated remote revision:", m.Revision)
+		}
+		return
+	}
+	w.current = m.Data
+	w.revision = m.Revision
+	w.revisionAuthor = m.Author
+	w.revisionRunStart = m.Revision
+	w.currentL.Unlock()
+	w.broadcast(command{Comm: commandInitialSend, Data: m.Data, Revision: m.Revision}, "")
+}
+
+// applyRemoteActive sets the writing permissions to a connection of another instance.
+// Caller must hold w.l.
+func (w *writer) applyRemoteActive(active string) {
+	if active == "" {
+		return
+	}
+	key, local := busLocal(active)
+	if w.active != key && w.connections[w.active] != nil {
+		w.send(w.active, command{Comm: commandStopWrite})
+	}
+	w.active = key
+	if local {
+		w.send(key, command{Comm: commandGetWrite})
+	}
+}
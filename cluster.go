@@ -0,0 +1,235 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/Top-Ranger/writergo/registry"
+)
+
+// clusterForwardedHeader marks requests which were already forwarded by another instance.
+const clusterForwardedHeader = "X-WriterGo-Forwarded"
+
+var leaser registry.Leaser
+var stopCluster = make(chan struct{})
+
+// clusterLease is the owner of a writer as known to this instance.
+type clusterLease struct {
+	owner   string
+	expires time.Time
+}
+
+// clusterLeases caches the owners of writers, so the DataSafe is not queried on every connection.
+var clusterLeases = make(map[string]clusterLease)
+var clusterLeasesLock sync.Mutex
+
+// initialiseCluster enables the cluster mode if configured.
+// In cluster mode, each writer is owned by exactly one instance. The ownership is coordinated through leases stored in the DataSafe.
+func initialiseCluster() error {
+	if config.ClusterInstance == "" {
+		return nil
+	}
+
+	l, ok := ds.(registry.Leaser)
+	if !ok {
+		return fmt.Errorf("DataSafe '%s' does not support cluster mode", config.DataSafe)
+	}
+	u, err := url.Parse(config.ClusterInstance)
+	if err != nil {
+		return fmt.Errorf("can not parse ClusterInstance: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("ClusterInstance must be a http or https URL")
+	}
+	leaser = l
+	log.Printf("cluster: running as instance '%s'", config.ClusterInstance)
+	if len(config.TrustedProxies) == 0 {
+		log.Println("cluster: TrustedProxies is empty, forwarded connections are limited by the address of the forwarding instance")
+	}
+	return nil
+}
+
+// clusterOwner returns the instance owning the writer.
+// If the writer is not owned by any instance, this instance becomes the owner.
+// Without cluster mode, this instance owns all writers.
+func clusterOwner(key string) (string, error) {
+	if leaser == nil {
+		return config.ClusterInstance, nil
+	}
+	clusterLeasesLock.Lock()
+	l, ok := clusterLeases[key]
+	clusterLeasesLock.Unlock()
+	if ok && time.Now().Before(l.expires) {
+		return l.owner, nil
+	}
+	return clusterAcquire(key)
+}
+
+// clusterAcquire acquires or renews the lease of a writer and caches the owner.
+// The owner is cached for the lease period, since no other instance can take over the lease before it expires.
+func clusterAcquire(key string) (string, error) {
+	d := time.Duration(config.ClusterLeaseSeconds) * time.Second
+	start := time.Now()
+	owner, err := leaser.AcquireLease(key, config.ClusterInstance, d)
+	if err != nil {
+		return "", err
+	}
+	clusterLeasesLock.Lock()
+	clusterLeases[key] = clusterLease{owner: owner, expires: start.Add(d)}
+	clusterLeasesLock.Unlock()
+	return owner, nil
+}
+
+// clusterForget removes the cached owner of a writer.
+func clusterForget(key string) {
+	clusterLeasesLock.Lock()
+	delete(clusterLeases, key)
+	clusterLeasesLock.Unlock()
+}
+
+// clusterForgetExpired removes all expired owners from the cache.
+func clusterForgetExpired() {
+	clusterLeasesLock.Lock()
+	defer clusterLeasesLock.Unlock()
+	now := time.Now()
+	for k := range clusterLeases {
+		if now.After(clusterLeases[k].expires) {
+			delete(clusterLeases, k)
+		}
+	}
+}
+
+// clusterRelease releases the ownership of a writer.
+func clusterRelease(key string) {
+	if leaser == nil {
+		return
+	}
+	clusterForget(key)
+	err := leaser.ReleaseLease(key, config.ClusterInstance)
+	if err != nil {
+		log.Printf("cluster: can not release %s: %s", key, err.Error())
+	}
+}
+
+// clusterForward forwards a websocket request to the instance owning the writer.
+func clusterForward(rw http.ResponseWriter, r *http.Request, key, owner string) {
+	if r.Header.Get(clusterForwardedHeader) != "" {
+		// Instances disagree about the owner - do not forward in circles
+		log.Printf("cluster: not forwarding already forwarded request to %s", owner)
+		clusterForget(key)
+		http.Error(rw, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+
+	u, err := url.Parse(owner)
+	if err != nil {
+		log.Printf("cluster: invalid owner '%s': %s", owner, err.Error())
+		http.Error(rw, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(u)
+	proxy.ErrorHandler = func(rw http.ResponseWriter, r *http.Request, err error) {
+		log.Printf("cluster: can not forward to %s: %s", owner, err.Error())
+		// The owner might be gone, ask the DataSafe again on the next connection
+		clusterForget(key)
+		rw.WriteHeader(http.StatusBadGateway)
+	}
+	r.Header.Set(clusterForwardedHeader, config.ClusterInstance)
+	proxy.ServeHTTP(rw, r)
+}
+
+// clusterLeaseWorker renews the leases of all local writers.
+// Writers whose lease was taken over by another instance are abandoned, so their clients reconnect to the new owner.
+func clusterLeaseWorker() {
+	if leaser == nil {
+		return
+	}
+
+	log.Println("cluster:", "lease worker started")
+
+	d := time.Duration(config.ClusterLeaseSeconds) * time.Second
+	t := time.NewTicker(d / 3)
+	defer t.Stop()
+
+	renewed := make(map[string]time.Time)
+
+	for {
+		select {
+		case <-stopCluster:
+			return
+		case <-t.C:
+			clusterForgetExpired()
+
+			writerMapLock.Lock()
+			writers := make(map[string]*writer, len(writerMap))
+			for k := range writerMap {
+				writers[k] = writerMap[k]
+			}
+			writerMapLock.Unlock()
+
+			for k := range renewed {
+				if writers[k] == nil {
+					delete(renewed, k)
+				}
+			}
+
+			for k := range writers {
+				if renewed[k].IsZero() {
+					// The lease was acquired when the writer was created
+					renewed[k] = time.Now()
+				}
+				owner, err := clusterAcquire(k)
+				if err != nil {
+					log.Printf("cluster: can not renew lease of %s: %s", k, err.Error())
+					if time.Since(renewed[k]) < d {
+						continue
+					}
+					owner = "unknown"
+				}
+				if owner == config.ClusterInstance {
+					renewed[k] = time.Now()
+					continue
+				}
+
+				log.Printf("cluster: lost %s to %s", k, owner)
+				if err != nil {
+					// No other instance is known to have taken over, so the changes might not be saved otherwise.
+					// Conflicting saves of a new owner are kept by the DataSafe.
+					err = writers[k].save()
+					if err != nil {
+						log.Printf("cluster: can not save %s: %s", k, err.Error())
+					}
+				}
+				delete(renewed, k)
+				writerMapLock.Lock()
+				if writerMap[k] == writers[k] {
+					writerMap[k].Abandon()
+					delete(writerMap, k)
+				}
+				writerMapLock.Unlock()
+			}
+		}
+	}
+}
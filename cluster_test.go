@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testLeaser grants all leases to owner and counts the requests.
+type testLeaser struct {
+	l        sync.Mutex
+	owner    string
+	err      error
+	acquired int
+}
+
+func (t *testLeaser) AcquireLease(key, instance string, d time.Duration) (string, error) {
+	t.l.Lock()
+	defer t.l.Unlock()
+	t.acquired++
+	return t.owner, t.err
+}
+
+func (t *testLeaser) ReleaseLease(key, instance string) error {
+	return nil
+}
+
+func TestClusterOwnerCache(t *testing.T) {
+	config.ClusterInstance = "http://a.example.com"
+	config.ClusterLeaseSeconds = 60
+	l := &testLeaser{owner: "http://b.example.com"}
+	leaser = l
+	t.Cleanup(func() {
+		leaser = nil
+		config.ClusterInstance = ""
+		clusterLeasesLock.Lock()
+		clusterLeases = make(map[string]clusterLease)
+		clusterLeasesLock.Unlock()
+	})
+
+	for i := 0; i < 3; i++ {
+		owner, err := clusterOwner("doc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if owner != "http://b.example.com" {
+			t.Errorf("owner is %s, want http://b.example.com", owner)
+		}
+	}
+	if l.acquired != 1 {
+		t.Errorf("leaser asked %d times, want 1", l.acquired)
+	}
+
+	clusterForget("doc")
+	l.owner = config.ClusterInstance
+	owner, err := clusterOwner("doc")
+	if err != nil || owner != config.ClusterInstance || l.acquired != 2 {
+		t.Errorf("after forget: owner %s (%v) after %d requests", owner, err, l.acquired)
+	}
+
+	// A failed renewal keeps the lease until it expires
+	l.err = errors.New("database down")
+	_, err = clusterAcquire("doc")
+	if err == nil {
+		t.Error("renewal did not fail")
+	}
+	owner, err = clusterOwner("doc")
+	if err != nil || owner != config.ClusterInstance {
+		t.Errorf("after failed renewal: owner %s (%v)", owner, err)
+	}
+
+	clusterRelease("doc")
+	_, err = clusterOwner("doc")
+	if err == nil {
+		t.Error("released lease still cached")
+	}
+}
@@ -0,0 +1,187 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"compress/flate"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// configEnvPrefix is the prefix of environment variables overriding the config.
+// The rest of the name is the upper case field name, e.g. WRITERGO_ADDRESS.
+const configEnvPrefix = "WRITERGO_"
+
+const redacted = "<redacted>"
+
+var (
+	redactCredentials = regexp.MustCompile(`((?:[a-zA-Z][a-zA-Z0-9+.-]*://)?[^\s:/@"]+):[^\s"]+@`)
+	redactSecretKeys  = regexp.MustCompile(`(?i)("[^"]*(password|secret|token|key)[^"]*"\s*:\s*)"(\\.|[^"\\])*"`)
+)
+
+// defaultConfig returns the configuration used for all values not set otherwise.
+func defaultConfig() ConfigStruct {
+	return ConfigStruct{
+		Language:               "en",
+		Address:                "localhost:8782",
+		PathImpressum:          "impressum.md",
+		PathDSGVO:              "DSGVO.md",
+		SyncSeconds:            1,
+		GCMinutes:              5,
+		ShutdownTimeoutSeconds: 10,
+		ResumeGraceSeconds:     30,
+		DefaultRole:            roleEditor,
+		CompressionLevel:       flate.BestSpeed,
+	}
+}
+
+// configFlags registers a flag for every config field on fs.
+// The flag name is the lower case field name. The returned map is filled with all given flags while parsing.
+func configFlags(fs *flag.FlagSet) map[string]string {
+	set := make(map[string]string)
+	t := reflect.TypeOf(ConfigStruct{})
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Name
+		fs.Func(strings.ToLower(name), fmt.Sprintf("Overrides %s of the config", name), func(s string) error {
+			set[name] = s
+			return nil
+		})
+	}
+	return set
+}
+
+// applyConfigEnv overrides the config with all set WRITERGO_* environment variables.
+func applyConfigEnv(c *ConfigStruct) error {
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		env := strings.Join([]string{configEnvPrefix, strings.ToUpper(name)}, "")
+		value, ok := os.LookupEnv(env)
+		if !ok {
+			continue
+		}
+		err := setConfigField(v.Field(i), value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", env, err)
+		}
+		log.Printf("load config: %s set from %s", name, env)
+	}
+	return nil
+}
+
+// applyConfigFlags overrides the config with all given flags.
+func applyConfigFlags(c *ConfigStruct, flags map[string]string) error {
+	v := reflect.ValueOf(c).Elem()
+	for name, value := range flags {
+		err := setConfigField(v.FieldByName(name), value)
+		if err != nil {
+			return fmt.Errorf("invalid -%s: %w", strings.ToLower(name), err)
+		}
+		log.Printf("load config: %s set from command line", name)
+	}
+	return nil
+}
+
+// setConfigField parses value into a config field.
+// Lists are separated by commas. Plug-in configurations are passed as given. All other values are given as JSON.
+func setConfigField(v reflect.Value, value string) error {
+	switch v.Type() {
+	case reflect.TypeOf(pluginConfig(nil)):
+		v.SetBytes([]byte(value))
+		return nil
+	case reflect.TypeOf([]string(nil)):
+		l := make([]string, 0)
+		for _, s := range strings.Split(value, ",") {
+			s = strings.TrimSpace(s)
+			if s != "" {
+				l = append(l, s)
+			}
+		}
+		v.Set(reflect.ValueOf(l))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Int, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || v.OverflowInt(i) {
+			return fmt.Errorf("'%s' is not a valid integer", value)
+		}
+		v.SetInt(i)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a valid boolean", value)
+		}
+		v.SetBool(b)
+	default:
+		// Decode into a new value so nothing of the previous layer is merged into it.
+		n := reflect.New(v.Type())
+		err := json.Unmarshal([]byte(value), n.Interface())
+		if err != nil {
+			return fmt.Errorf("'%s' is not valid JSON: %w", value, err)
+		}
+		v.Set(n.Elem())
+	}
+	return nil
+}
+
+// printConfig writes the effective config as JSON.
+// Secrets in fields tagged as secret are redacted, fields tagged with secret:"all" are redacted completely.
+func printConfig(w io.Writer, c ConfigStruct) error {
+	v := reflect.ValueOf(&c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		tag := v.Type().Field(i).Tag.Get("secret")
+		if tag != "true" && tag != "all" {
+			continue
+		}
+		f := v.Field(i)
+		switch f.Kind() {
+		case reflect.String:
+			if tag == "all" && f.String() != "" {
+				f.SetString(redacted)
+				continue
+			}
+			f.SetString(redactSecret(f.String()))
+		case reflect.Slice:
+			if f.Type().Elem().Kind() == reflect.Uint8 {
+				f.SetBytes([]byte(redactSecret(string(f.Bytes()))))
+			}
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "   ")
+	return enc.Encode(c)
+}
+
+// redactSecret removes passwords from DSNs and URLs as well as values of secret keys in JSON objects.
+// Everything else is kept so the output is still useful for debugging.
+func redactSecret(s string) string {
+	s = redactCredentials.ReplaceAllString(s, strings.Join([]string{"$1:", redacted, "@"}, ""))
+	return redactSecretKeys.ReplaceAllString(s, strings.Join([]string{`$1"`, redacted, `"`}, ""))
+}
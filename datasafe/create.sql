@@ -1,2 +1,4 @@
-CREATE DATABASE writergo;
-CREATE TABLE writergo.writer (`key` VARCHAR(600) NOT NULL, data LONGTEXT NOT NULL, PRIMARY KEY(`key`));
\ No newline at end of file
+CREATE DATABASE writergo CHARACTER SET utf8mb4;
+CREATE TABLE writergo.writer (`key` VARCHAR(600) NOT NULL, data LONGTEXT NOT NULL, PRIMARY KEY(`key`)) CHARACTER SET utf8mb4;
+CREATE TABLE writergo.lease (`key` VARCHAR(600) NOT NULL, owner VARCHAR(600) NOT NULL, expires DATETIME(3) NOT NULL, PRIMARY KEY(`key`));
+CREATE TABLE writergo.token (hash CHAR(64) NOT NULL, id VARCHAR(64) NOT NULL, user VARCHAR(600) NOT NULL, scopes VARCHAR(200) NOT NULL, created BIGINT NOT NULL, PRIMARY KEY(hash), UNIQUE(id));
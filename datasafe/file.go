@@ -17,6 +17,9 @@ package datasafe
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
@@ -42,60 +45,285 @@ func init() {
 	}
 }
 
+// fileTempPattern is the pattern of temporary files.
+// Since generateKey replaces all dots, they can not collide with saved writers.
+const fileTempPattern = ".tmp-*"
+
+// fileBackupSuffix is appended to the file name of the previous version of a writer.
+const fileBackupSuffix = ".bak"
+
+// fileTokenDir is the directory API tokens are stored in.
+// Since generateKey replaces all dots, it can not collide with saved writers.
+const fileTokenDir = ".tokens"
+
+// FileConfig is the configuration of the File DataSafe.
+// For backwards compatibility, the configuration may also be the plain path.
+type FileConfig struct {
+	Path string
+	// Sharded stores writers in two levels of subdirectories named after the hash of the key.
+	// Writers still stored in the flat layout are read transparently. Use Relayout to move them.
+	Sharded bool
+}
+
+// fileRead is the result of reading a writer in the worker.
+type fileRead struct {
+	data string
+	err  error
+}
+
 type File struct {
-	path  string
-	write chan struct{ key, data string }
-	read  chan struct {
+	path    string
+	sharded bool
+	write   chan struct {
+		key, data string
+		back      chan<- error
+	}
+	read chan struct {
 		key  string
-		back chan<- string
+		back chan<- fileRead
+	}
+	swap chan struct {
+		key, data, version string
+		back               chan<- error
 	}
 	flushed chan bool
 	start   sync.Once
 	stop    context.CancelFunc
+	tokenL  sync.Mutex
 }
 
 func (f *File) SaveWriter(key, data string) error {
-	go func() { f.write <- struct{ key, data string }{key, data} }()
-	return nil
+	back := make(chan error, 1)
+	f.write <- struct {
+		key, data string
+		back      chan<- error
+	}{key, data, back}
+	return <-back
 }
 
 func (f *File) LoadWriter(key string) (string, error) {
-	back := make(chan string, 1)
+	back := make(chan fileRead, 1)
 	f.read <- struct {
 		key  string
-		back chan<- string
+		back chan<- fileRead
 	}{key, back}
-	return <-back, nil
+	r := <-back
+	return r.data, r.err
+}
+
+func (f *File) LoadWriterVersion(key string) (string, string, error) {
+	data, err := f.LoadWriter(key)
+	return data, version(data), err
+}
+
+func (f *File) SaveWriterVersion(key, data, expected string) (string, error) {
+	back := make(chan error, 1)
+	f.swap <- struct {
+		key, data, version string
+		back               chan<- error
+	}{key, data, expected, back}
+	err := <-back
+	if err != nil {
+		return "", err
+	}
+	return version(data), nil
+}
+
+func (f *File) SaveToken(t registry.APIToken) error {
+	path, err := f.tokenPath(t.Hash)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(&t)
+	if err != nil {
+		return fmt.Errorf("file: can not encode token: %w", err)
+	}
+
+	f.tokenL.Lock()
+	defer f.tokenL.Unlock()
+
+	dir := filepath.Dir(path)
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return fmt.Errorf("file: can not create token directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, fileTempPattern)
+	if err != nil {
+		return fmt.Errorf("file: can not create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // Does nothing after a successful rename
+
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("file: can not write token: %w", err)
+	}
+	err = tmp.Close()
+	if err != nil {
+		return fmt.Errorf("file: can not close temporary file: %w", err)
+	}
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return fmt.Errorf("file: can not store token: %w", err)
+	}
+	return f.syncDir(dir)
+}
+
+func (f *File) LoadToken(hash string) (registry.APIToken, bool, error) {
+	path, err := f.tokenPath(hash)
+	if err != nil {
+		// Not a valid hash, so there can not be a token
+		return registry.APIToken{}, false, nil
+	}
+
+	f.tokenL.Lock()
+	defer f.tokenL.Unlock()
+
+	b, err := ioutil.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return registry.APIToken{}, false, nil
+	}
+	if err != nil {
+		return registry.APIToken{}, false, fmt.Errorf("file: can not read token: %w", err)
+	}
+	var t registry.APIToken
+	err = json.Unmarshal(b, &t)
+	if err != nil {
+		return registry.APIToken{}, false, fmt.Errorf("file: can not parse token: %w", err)
+	}
+	return t, true, nil
+}
+
+func (f *File) ListTokens() ([]registry.APIToken, error) {
+	f.tokenL.Lock()
+	defer f.tokenL.Unlock()
+	return f.listTokens()
+}
+
+// listTokens returns all stored tokens.
+// Caller must hold f.tokenL.
+func (f *File) listTokens() ([]registry.APIToken, error) {
+	entries, err := os.ReadDir(filepath.Join(f.path, fileTokenDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("file: can not read token directory: %w", err)
+	}
+
+	tokens := make([]registry.APIToken, 0, len(entries))
+	for i := range entries {
+		if !entries[i].Type().IsRegular() || strings.HasPrefix(entries[i].Name(), ".") {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(f.path, fileTokenDir, entries[i].Name()))
+		if err != nil {
+			return nil, fmt.Errorf("file: can not read token: %w", err)
+		}
+		var t registry.APIToken
+		err = json.Unmarshal(b, &t)
+		if err != nil {
+			return nil, fmt.Errorf("file: can not parse token '%s': %w", entries[i].Name(), err)
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
+
+func (f *File) DeleteToken(id string) error {
+	f.tokenL.Lock()
+	defer f.tokenL.Unlock()
+
+	tokens, err := f.listTokens()
+	if err != nil {
+		return err
+	}
+	for i := range tokens {
+		if tokens[i].ID != id {
+			continue
+		}
+		path, err := f.tokenPath(tokens[i].Hash)
+		if err != nil {
+			return err
+		}
+		err = os.Remove(path)
+		if err != nil {
+			return fmt.Errorf("file: can not remove token: %w", err)
+		}
+		return f.syncDir(filepath.Dir(path))
+	}
+	return registry.ErrUnknownToken
+}
+
+// tokenPath returns the path a token with the given hash is stored at.
+// Only valid SHA-256 hashes are accepted, so the hash can not escape the token directory.
+func (f *File) tokenPath(hash string) (string, error) {
+	b, err := hex.DecodeString(hash)
+	if err != nil || len(b) != sha256.Size {
+		return "", errors.New("file: invalid token hash")
+	}
+	return filepath.Join(f.path, fileTokenDir, strings.ToLower(hash)), nil
 }
 
 func (f *File) LoadConfig(data []byte) error {
 	run := false
 
-	stat, err := os.Stat(string(data))
+	c := FileConfig{}
+	err := registry.DecodeConfig(data, &c, func(s string) { c.Path = s })
+	if err != nil {
+		return fmt.Errorf("file: %w", err)
+	}
+	if c.Path == "" {
+		return errors.New("file: no path given, set DataSafeConfig to the target directory or to an object with 'Path'")
+	}
+
+	stat, err := os.Stat(c.Path)
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
-			err = os.MkdirAll(string(data), 0700)
+			err = os.MkdirAll(c.Path, 0700)
 			if err != nil {
-				return fmt.Errorf("can not create path '%s': %w", string(data), err)
+				return fmt.Errorf("file: can not create path '%s': %w", c.Path, err)
 			}
 		} else {
-			return fmt.Errorf("can not check path '%s': %w", string(data), err)
+			return fmt.Errorf("file: can not check path '%s': %w", c.Path, err)
 		}
 	} else {
 		if !stat.IsDir() {
-			return fmt.Errorf("path '%s' is not a directory", string(data))
+			return fmt.Errorf("file: path '%s' is not a directory", c.Path)
+		}
+	}
+
+	// Remove leftovers of interrupted writes, writers and tokens use different directories
+	for _, dir := range []string{c.Path, filepath.Join(c.Path, fileTokenDir)} {
+		tmp, err := filepath.Glob(filepath.Join(dir, fileTempPattern))
+		if err != nil {
+			return fmt.Errorf("file: can not search temporary files: %w", err)
+		}
+		for i := range tmp {
+			err = os.Remove(tmp[i])
+			if err != nil {
+				log.Println("file: can not remove temporary file:", err)
+			}
 		}
 	}
 
 	f.start.Do(func() {
-		f.path = string(data)
+		f.path = c.Path
+		f.sharded = c.Sharded
 		f.write = make(chan struct {
-			key  string
-			data string
+			key, data string
+			back      chan<- error
 		}, 10)
 		f.read = make(chan struct {
 			key  string
-			back chan<- string
+			back chan<- fileRead
+		}, 1)
+		f.swap = make(chan struct {
+			key, data, version string
+			back               chan<- error
 		}, 1)
 		f.flushed = make(chan bool, 1)
 		run = true
@@ -119,6 +347,7 @@ func (f *File) FlushAndClose() {
 	<-f.flushed
 	f.write = nil
 	f.read = nil
+	f.swap = nil
 }
 
 func (*File) generateKey(key string) string {
@@ -127,6 +356,191 @@ func (*File) generateKey(key string) string {
 	return key
 }
 
+// flatPath returns the path of a writer in the flat layout.
+// The name must be generated through generateKey.
+func (f *File) flatPath(name string) string {
+	return filepath.Join(f.path, name)
+}
+
+// shardedPath returns the path of a writer in the sharded layout.
+// The name must be generated through generateKey.
+func (f *File) shardedPath(name string) string {
+	h := sha256.Sum256([]byte(name))
+	s := hex.EncodeToString(h[:])
+	return filepath.Join(f.path, s[0:2], s[2:4], name)
+}
+
+// filePath returns the path a writer is stored at in the configured layout.
+func (f *File) filePath(name string) string {
+	if f.sharded {
+		return f.shardedPath(name)
+	}
+	return f.flatPath(name)
+}
+
+// readFile reads the data of a writer.
+// In the sharded layout, writers which were not moved yet are read from the flat layout.
+func (f *File) readFile(name string) ([]byte, error) {
+	b, err := ioutil.ReadFile(f.filePath(name))
+	if f.sharded && errors.Is(err, fs.ErrNotExist) {
+		b, err = ioutil.ReadFile(f.flatPath(name))
+	}
+	return b, err
+}
+
+// moveToShard moves a writer including its backup from the flat to the sharded layout.
+// Writers already stored in the sharded layout are not touched.
+func (f *File) moveToShard(name string) error {
+	flat := f.flatPath(name)
+	path := f.shardedPath(name)
+
+	_, err := os.Stat(path)
+	if err == nil {
+		if _, err := os.Stat(flat); err == nil {
+			log.Printf("file: '%s' exists in both layouts, using sharded layout", name)
+		}
+		return nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("can not check file: %w", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return fmt.Errorf("can not create directory: %w", err)
+	}
+
+	// Move the backup first, so the writer is never separated from it
+	for _, suffix := range []string{fileBackupSuffix, ""} {
+		err = os.Rename(strings.Join([]string{flat, suffix}, ""), strings.Join([]string{path, suffix}, ""))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("can not move file: %w", err)
+		}
+	}
+
+	err = f.syncDir(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	return f.syncDir(f.path)
+}
+
+// Relayout moves all writers stored in the flat layout to the sharded layout.
+// It must be called before the DataSafe is used.
+func (f *File) Relayout() error {
+	if !f.sharded {
+		return errors.New("sharded layout is not enabled")
+	}
+
+	entries, err := os.ReadDir(f.path)
+	if err != nil {
+		return fmt.Errorf("can not read directory: %w", err)
+	}
+
+	moved := 0
+	for i := range entries {
+		name := entries[i].Name()
+		// Temporary files start with a dot, backups are moved together with their writer
+		if !entries[i].Type().IsRegular() || strings.HasPrefix(name, ".") || strings.HasSuffix(name, fileBackupSuffix) {
+			continue
+		}
+		err = f.moveToShard(name)
+		if err != nil {
+			return fmt.Errorf("can not move '%s': %w", name, err)
+		}
+		moved++
+	}
+	log.Printf("file: moved %d writers to sharded layout", moved)
+	return nil
+}
+
+// writeFile writes the data of a writer to disk.
+// The data is written to a temporary file first, which replaces the old file after it is synced to disk.
+// The previous version is kept as a backup.
+// It must only be called from the worker.
+func (f *File) writeFile(key, data string) error {
+	name := f.generateKey(key)
+	path := f.filePath(name)
+
+	if f.sharded {
+		err := f.moveToShard(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	tmp, err := os.CreateTemp(f.path, fileTempPattern)
+	if err != nil {
+		return fmt.Errorf("can not create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // Does nothing after a successful rename
+
+	_, err = tmp.WriteString(data)
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("can not write data: %w", err)
+	}
+	err = tmp.Sync()
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("can not sync data: %w", err)
+	}
+	err = tmp.Close()
+	if err != nil {
+		return fmt.Errorf("can not close temporary file: %w", err)
+	}
+
+	err = f.backupFile(path)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return fmt.Errorf("can not replace file: %w", err)
+	}
+	return f.syncDir(filepath.Dir(path))
+}
+
+// backupFile keeps the current version of the file as a backup.
+func (f *File) backupFile(path string) error {
+	backup := strings.Join([]string{path, fileBackupSuffix}, "")
+	err := os.Remove(backup)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("can not remove old backup: %w", err)
+	}
+
+	err = os.Link(path, backup)
+	if err == nil || errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	// Not all file systems support hard links
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("can not read file for backup: %w", err)
+	}
+	err = ioutil.WriteFile(backup, b, 0600)
+	if err != nil {
+		return fmt.Errorf("can not write backup: %w", err)
+	}
+	return nil
+}
+
+// syncDir ensures that renames in a directory are persisted.
+func (f *File) syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("can not open directory: %w", err)
+	}
+	defer dir.Close()
+	err = dir.Sync()
+	if err != nil {
+		return fmt.Errorf("can not sync directory: %w", err)
+	}
+	return nil
+}
+
 func (f *File) worker(ctx context.Context) {
 	closer := ctx.Done()
 	var closer2 <-chan time.Time
@@ -135,21 +549,29 @@ func (f *File) worker(ctx context.Context) {
 	for {
 		select {
 		case d := <-f.write:
-			d.key = f.generateKey(d.key)
-			func() {
-				path := filepath.Join(f.path, d.key)
-				f, err := os.Create(path)
-				if err != nil {
-					log.Println("file write: can not open file:", err)
-					return
-				}
-				defer f.Close()
-				_, err = f.WriteString(d.data)
-				if err != nil {
-					log.Println("file write: can not write data:", err)
-					return
+			err := f.writeFile(d.key, d.data)
+			if err != nil {
+				err = fmt.Errorf("file write: %w", err)
+			}
+			d.back <- err
+			if t != nil {
+				if !t.Stop() {
+					<-t.C
 				}
-			}()
+				t.Reset(1 * time.Second)
+				closer2 = t.C
+			}
+		case d := <-f.swap:
+			b, err := f.readFile(f.generateKey(d.key))
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				d.back <- fmt.Errorf("file swap: can not read data: %w", err)
+				break
+			}
+			if version(string(b)) != d.version {
+				d.back <- registry.ErrVersionConflict
+				break
+			}
+			d.back <- f.writeFile(d.key, d.data)
 			if t != nil {
 				if !t.Stop() {
 					<-t.C
@@ -158,19 +580,16 @@ func (f *File) worker(ctx context.Context) {
 				closer2 = t.C
 			}
 		case d := <-f.read:
-			d.key = f.generateKey(d.key)
-			func() {
-				path := filepath.Join(f.path, d.key)
-				b, err := ioutil.ReadFile(path)
-				if err != nil {
-					if !errors.Is(err, fs.ErrNotExist) {
-						log.Println("file read: can not read data:", err)
-					}
-					d.back <- ""
-					return
-				}
-				d.back <- string(b)
-			}()
+			b, err := f.readFile(f.generateKey(d.key))
+			switch {
+			case errors.Is(err, fs.ErrNotExist):
+				d.back <- fileRead{}
+			case err != nil:
+				// Callers must not mistake an unreadable writer for a new one, e.g. when checking its ACL
+				d.back <- fileRead{err: fmt.Errorf("file read: can not read data: %w", err)}
+			default:
+				d.back <- fileRead{data: string(b)}
+			}
 		case <-closer:
 			// Wait 1s if writes occur
 			// This should avoid mussing writes
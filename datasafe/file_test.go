@@ -0,0 +1,290 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasafe
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Top-Ranger/writergo/registry"
+)
+
+// testFile returns a File DataSafe storing its data in a new temporary directory.
+func testFile(t *testing.T, sharded bool) (*File, string) {
+	t.Helper()
+	dir := t.TempDir()
+	c, err := json.Marshal(FileConfig{Path: dir, Sharded: sharded})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &File{}
+	err = f.LoadConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(f.FlushAndClose)
+	return f, dir
+}
+
+// checkFile fails the test if the file does not have the given content.
+func checkFile(t *testing.T, path, want string) {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != want {
+		t.Errorf("%s: got '%s', want '%s'", filepath.Base(path), b, want)
+	}
+}
+
+func TestFileRemovesTemporaryFiles(t *testing.T) {
+	dir := t.TempDir()
+	err := os.Mkdir(filepath.Join(dir, fileTokenDir), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]bool{
+		".tmp-123":                              true,
+		filepath.Join(fileTokenDir, ".tmp-456"): true,
+		"writer":                                false,
+		filepath.Join(fileTokenDir, "0123456789"): false,
+	}
+	for name := range files {
+		err = os.WriteFile(filepath.Join(dir, name), []byte("data"), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f := &File{}
+	err = f.LoadConfig([]byte(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.FlushAndClose()
+
+	for name, want := range files {
+		_, err = os.Stat(filepath.Join(dir, name))
+		if removed := errors.Is(err, fs.ErrNotExist); removed != want {
+			t.Errorf("%s: removed %t, want %t", name, removed, want)
+		}
+	}
+}
+
+func TestFileKeepsBackup(t *testing.T) {
+	f, dir := testFile(t, false)
+	for _, data := range []string{"first", "second", "third"} {
+		err := f.SaveWriter("key", data)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkFile(t, filepath.Join(dir, "key"), "third")
+	checkFile(t, filepath.Join(dir, "key"+fileBackupSuffix), "second")
+
+	tmp, err := filepath.Glob(filepath.Join(dir, fileTempPattern))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tmp) != 0 {
+		t.Errorf("temporary files left: %v", tmp)
+	}
+}
+
+func TestFileFailedWrite(t *testing.T) {
+	f, dir := testFile(t, true)
+	flat := filepath.Join(dir, "key")
+	err := os.WriteFile(flat, []byte("current"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(flat+fileBackupSuffix, []byte("previous"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A file in place of the shard directory makes the write fail
+	shard := f.shardedPath("key")
+	err = os.WriteFile(filepath.Dir(filepath.Dir(shard)), nil, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = f.SaveWriter("key", "new")
+	if err == nil {
+		t.Fatal("write did not fail")
+	}
+	_, err = f.SaveWriterVersion("key", "new", version("current"))
+	if err == nil || errors.Is(err, registry.ErrVersionConflict) {
+		t.Fatalf("got %v, want write error", err)
+	}
+
+	checkFile(t, flat, "current")
+	checkFile(t, flat+fileBackupSuffix, "previous")
+	err = os.Remove(filepath.Dir(filepath.Dir(shard)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := f.LoadWriter("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data != "current" {
+		t.Errorf("got '%s', want 'current'", data)
+	}
+}
+
+func TestFileSaveWriterVersion(t *testing.T) {
+	f, dir := testFile(t, false)
+
+	data, v, err := f.LoadWriterVersion("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data != "" {
+		t.Fatalf("new writer has data '%s'", data)
+	}
+	first, err := f.SaveWriterVersion("key", "first", v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.SaveWriterVersion("key", "second", first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, stale := range []string{v, first, "unknown"} {
+		_, err = f.SaveWriterVersion("key", "stale", stale)
+		if !errors.Is(err, registry.ErrVersionConflict) {
+			t.Errorf("version '%s': got %v, want %v", stale, err, registry.ErrVersionConflict)
+		}
+	}
+	checkFile(t, filepath.Join(dir, "key"), "second")
+	checkFile(t, filepath.Join(dir, "key"+fileBackupSuffix), "first")
+}
+
+func TestFileShardedLayout(t *testing.T) {
+	f, dir := testFile(t, true)
+	err := f.SaveWriter("a/b.c", "data")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := f.generateKey("a/b.c")
+	path := f.shardedPath(name)
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(strings.Split(filepath.ToSlash(rel), "/")) != 3 {
+		t.Errorf("writer stored at %s, want two levels of subdirectories", rel)
+	}
+	checkFile(t, path, "data")
+	_, err = os.Stat(f.flatPath(name))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("writer stored in flat layout: %v", err)
+	}
+}
+
+func TestFileShardedReadsFlatLayout(t *testing.T) {
+	f, dir := testFile(t, true)
+	err := os.WriteFile(filepath.Join(dir, "key"), []byte("flat"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "key"+fileBackupSuffix), []byte("backup"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, v, err := f.LoadWriterVersion("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data != "flat" {
+		t.Fatalf("got '%s', want 'flat'", data)
+	}
+
+	// Writing moves the writer to the sharded layout, keeping the old data as backup
+	_, err = f.SaveWriterVersion("key", "sharded", v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, f.shardedPath("key"), "sharded")
+	checkFile(t, f.shardedPath("key")+fileBackupSuffix, "flat")
+	for _, name := range []string{"key", "key" + fileBackupSuffix} {
+		_, err = os.Stat(filepath.Join(dir, name))
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%s left in flat layout: %v", name, err)
+		}
+	}
+}
+
+func TestFileRelayout(t *testing.T) {
+	dir := t.TempDir()
+	flat := map[string]string{
+		"one":                      "1",
+		"one" + fileBackupSuffix:   "1 backup",
+		"two":                      "2",
+		"three" + fileBackupSuffix: "only backup",
+	}
+	for name, data := range flat {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f := &File{path: dir}
+	err := f.Relayout()
+	if err == nil {
+		t.Error("relayout without sharded layout did not fail")
+	}
+	f.sharded = true
+	err = f.Relayout()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range flat {
+		_, err = os.Stat(filepath.Join(dir, name))
+		if name == "three"+fileBackupSuffix {
+			// Backups without writer are not moved
+			if err != nil {
+				t.Errorf("%s: %v", name, err)
+			}
+			continue
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%s left in flat layout: %v", name, err)
+		}
+		key := strings.TrimSuffix(name, fileBackupSuffix)
+		checkFile(t, strings.Join([]string{f.shardedPath(key), name[len(key):]}, ""), data)
+	}
+
+	// Running it again does not change anything
+	err = f.Relayout()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, f.shardedPath("one"), "1")
+	checkFile(t, f.shardedPath("one")+fileBackupSuffix, "1 backup")
+}
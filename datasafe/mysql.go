@@ -21,10 +21,11 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/Top-Ranger/writergo/registry"
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 )
 
 func init() {
@@ -47,6 +48,20 @@ var ErrMySQLIDtooLong = errors.New("mysql: id is too long")
 // ErrMySQLNotConfigured is returned when the database is used before it is configured
 var ErrMySQLNotConfigured = errors.New("mysql: usage before configuration is used")
 
+// MySQLConfig is the configuration of the MySQL DataSafe.
+// For backwards compatibility, the configuration may also be the plain DSN.
+type MySQLConfig struct {
+	DSN                    string
+	MaxOpenConns           int
+	MaxIdleConns           int
+	ConnMaxLifetimeSeconds int
+}
+
+const (
+	mysqlDefaultMaxConns               = 10
+	mysqlDefaultConnMaxLifetimeSeconds = 60
+)
+
 type MySQL struct {
 	dsn string
 	db  *sql.DB
@@ -89,19 +104,210 @@ func (m *MySQL) LoadWriter(key string) (string, error) {
 	return "", nil
 }
 
+func (m *MySQL) LoadWriterVersion(key string) (string, string, error) {
+	data, err := m.LoadWriter(key)
+	return data, version(data), err
+}
+
+func (m *MySQL) SaveWriterVersion(key, data, expected string) (string, error) {
+	if m.db == nil {
+		return "", ErrMySQLNotConfigured
+	}
+
+	if len(key) > MySQLMaxLengthID {
+		return "", ErrMySQLIDtooLong
+	}
+
+	var res sql.Result
+	var err error
+	if expected == "" {
+		res, err = m.db.Exec("INSERT INTO writer (`key`, data) VALUES (?,?) ON DUPLICATE KEY UPDATE data = IF(data = '', VALUES(data), data)", key, data)
+	} else {
+		// The version is the SHA-256 of the UTF-8 encoded data, independent of the charset of the column
+		res, err = m.db.Exec("UPDATE writer SET data=? WHERE `key`=? AND SHA2(CONVERT(data USING utf8mb4), 256)=?", data, key, expected)
+	}
+	if err != nil {
+		return "", err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+	if n == 0 {
+		// Either the versions did not match or the data did not change
+		current, err := m.LoadWriter(key)
+		if err != nil {
+			return "", err
+		}
+		if current != data {
+			return "", registry.ErrVersionConflict
+		}
+	}
+	return version(data), nil
+}
+
+func (m *MySQL) AcquireLease(key, instance string, d time.Duration) (string, error) {
+	if m.db == nil {
+		return "", ErrMySQLNotConfigured
+	}
+
+	if len(key) > MySQLMaxLengthID {
+		return "", ErrMySQLIDtooLong
+	}
+
+	// Assignments are evaluated from left to right, so expires is only updated if owner is (now) instance.
+	// The time of the database is used to avoid problems with clock skew between instances.
+	_, err := m.db.Exec("INSERT INTO lease (`key`, owner, expires) VALUES (?, ?, NOW(3) + INTERVAL ? MICROSECOND) ON DUPLICATE KEY UPDATE owner = IF(owner = VALUES(owner) OR expires < NOW(3), VALUES(owner), owner), expires = IF(owner = VALUES(owner), VALUES(expires), expires)", key, instance, d.Microseconds())
+	if err != nil {
+		return "", err
+	}
+
+	var owner string
+	err = m.db.QueryRow("SELECT owner FROM lease WHERE `key`=?", key).Scan(&owner)
+	return owner, err
+}
+
+func (m *MySQL) ReleaseLease(key, instance string) error {
+	if m.db == nil {
+		return ErrMySQLNotConfigured
+	}
+
+	if len(key) > MySQLMaxLengthID {
+		return ErrMySQLIDtooLong
+	}
+
+	_, err := m.db.Exec("DELETE FROM lease WHERE `key`=? AND owner=?", key, instance)
+	return err
+}
+
+func (m *MySQL) SaveToken(t registry.APIToken) error {
+	if m.db == nil {
+		return ErrMySQLNotConfigured
+	}
+
+	_, err := m.db.Exec("INSERT INTO token (hash, id, user, scopes, created) VALUES (?,?,?,?,?)", t.Hash, t.ID, t.User, strings.Join(t.Scopes, ","), t.Created.Unix())
+	return err
+}
+
+func (m *MySQL) LoadToken(hash string) (registry.APIToken, bool, error) {
+	if m.db == nil {
+		return registry.APIToken{}, false, ErrMySQLNotConfigured
+	}
+
+	t, err := m.scanToken(m.db.QueryRow("SELECT hash, id, user, scopes, created FROM token WHERE hash=?", hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return registry.APIToken{}, false, nil
+	}
+	if err != nil {
+		return registry.APIToken{}, false, err
+	}
+	return t, true, nil
+}
+
+func (m *MySQL) ListTokens() ([]registry.APIToken, error) {
+	if m.db == nil {
+		return nil, ErrMySQLNotConfigured
+	}
+
+	rows, err := m.db.Query("SELECT hash, id, user, scopes, created FROM token ORDER BY created")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []registry.APIToken
+	for rows.Next() {
+		t, err := m.scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func (m *MySQL) DeleteToken(id string) error {
+	if m.db == nil {
+		return ErrMySQLNotConfigured
+	}
+
+	res, err := m.db.Exec("DELETE FROM token WHERE id=?", id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return registry.ErrUnknownToken
+	}
+	return nil
+}
+
+// scanToken reads a token from a row selecting hash, id, user, scopes and created.
+func (m *MySQL) scanToken(row interface{ Scan(dest ...any) error }) (registry.APIToken, error) {
+	var t registry.APIToken
+	var scopes string
+	var created int64
+	err := row.Scan(&t.Hash, &t.ID, &t.User, &scopes, &created)
+	if err != nil {
+		return registry.APIToken{}, err
+	}
+	if scopes != "" {
+		t.Scopes = strings.Split(scopes, ",")
+	}
+	t.Created = time.Unix(created, 0)
+	return t, nil
+}
+
 func (m *MySQL) LoadConfig(data []byte) error {
-	m.dsn = string(data)
+	c := MySQLConfig{}
+	err := registry.DecodeConfig(data, &c, func(s string) { c.DSN = s })
+	if err != nil {
+		return fmt.Errorf("mysql: %w", err)
+	}
+
+	if c.DSN == "" {
+		return errors.New("mysql: no DSN given, set DataSafeConfig to the DSN or to an object with 'DSN'")
+	}
+	_, err = mysql.ParseDSN(c.DSN)
+	if err != nil {
+		// Do not include the DSN, it usually contains the password
+		return fmt.Errorf("mysql: invalid DSN: %w", err)
+	}
+	if c.MaxOpenConns < 0 || c.MaxIdleConns < 0 || c.ConnMaxLifetimeSeconds < 0 {
+		return errors.New("mysql: MaxOpenConns, MaxIdleConns and ConnMaxLifetimeSeconds must not be negative")
+	}
+	if c.MaxOpenConns == 0 {
+		c.MaxOpenConns = mysqlDefaultMaxConns
+	}
+	if c.MaxIdleConns == 0 {
+		c.MaxIdleConns = c.MaxOpenConns
+	}
+	if c.MaxIdleConns > c.MaxOpenConns {
+		return fmt.Errorf("mysql: MaxIdleConns (%d) must not be larger than MaxOpenConns (%d)", c.MaxIdleConns, c.MaxOpenConns)
+	}
+	if c.ConnMaxLifetimeSeconds == 0 {
+		c.ConnMaxLifetimeSeconds = mysqlDefaultConnMaxLifetimeSeconds
+	}
+
+	m.dsn = c.DSN
 	db, err := sql.Open("mysql", m.dsn)
 	if err != nil {
-		return fmt.Errorf("mysql: can not open '%s': %w", m.dsn, err)
+		return fmt.Errorf("mysql: can not open database: %w", err)
 	}
-	db.SetConnMaxLifetime(time.Minute * 1)
-	db.SetMaxOpenConns(10)
-	db.SetMaxIdleConns(10)
+	db.SetConnMaxLifetime(time.Duration(c.ConnMaxLifetimeSeconds) * time.Second)
+	db.SetMaxOpenConns(c.MaxOpenConns)
+	db.SetMaxIdleConns(c.MaxIdleConns)
 	m.db = db
 	return nil
 }
 
+func (m *MySQL) MaxKeyLength() int {
+	return MySQLMaxLengthID
+}
+
 func (m *MySQL) IsPermanent() bool {
 	return true
 }
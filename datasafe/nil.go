@@ -15,7 +15,12 @@
 
 package datasafe
 
-import "github.com/Top-Ranger/writergo/registry"
+import (
+	"bytes"
+	"log"
+
+	"github.com/Top-Ranger/writergo/registry"
+)
 
 func init() {
 	err := registry.RegisterDataSafe(&Nil{}, "")
@@ -36,6 +41,12 @@ type Nil struct{}
 
 func (*Nil) SaveWriter(key, data string) error     { return nil }
 func (*Nil) LoadWriter(key string) (string, error) { return "", nil }
-func (*Nil) LoadConfig(data []byte) error          { return nil }
 func (*Nil) IsPermanent() bool                     { return false }
 func (*Nil) FlushAndClose()                        {}
+
+func (*Nil) LoadConfig(data []byte) error {
+	if len(bytes.TrimSpace(data)) != 0 {
+		log.Println("nil: DataSafeConfig is ignored, since no data is stored")
+	}
+	return nil
+}
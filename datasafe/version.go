@@ -0,0 +1,31 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasafe
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// version returns the version of the data as used by registry.VersionedDataSafe.
+// An empty state has the empty version, so it can not be distinguished from a writer without saved state.
+func version(data string) string {
+	if data == "" {
+		return ""
+	}
+	h := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(h[:])
+}
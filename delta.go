@@ -0,0 +1,357 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// delta represents a Quill document.
+// Only documents consisting of inserts are supported.
+type delta struct {
+	Ops []deltaOp `json:"ops"`
+}
+
+type deltaOp struct {
+	Insert     interface{}            `json:"insert"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+type attributeValidator func(json.RawMessage) (interface{}, error)
+
+var (
+	deltaColour       = regexp.MustCompile(`^(#[0-9a-fA-F]{3,8}|rgba?\([0-9., %]+\)|[a-zA-Z]+)$`)
+	deltaCodeLanguage = regexp.MustCompile(`^[a-zA-Z0-9+#_-]+$`)
+	deltaImageSize    = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?(px|%)?$`)
+	deltaDataImage    = regexp.MustCompile(`^data:image/(png|jpeg|gif|webp|bmp);base64,[a-zA-Z0-9+/]+=*$`)
+)
+
+// deltaTextAttributes contains all attributes allowed on any insert.
+var deltaTextAttributes = map[string]attributeValidator{
+	"bold":       boolAttribute,
+	"italic":     boolAttribute,
+	"underline":  boolAttribute,
+	"strike":     boolAttribute,
+	"code":       boolAttribute,
+	"blockquote": boolAttribute,
+	"code-block": codeBlockAttribute,
+	"header":     intAttribute(1, 6),
+	"indent":     intAttribute(1, 8),
+	"list":       enumAttribute("ordered", "bullet", "checked", "unchecked"),
+	"script":     enumAttribute("sub", "super"),
+	"align":      enumAttribute("center", "right", "justify"),
+	"direction":  enumAttribute("rtl"),
+	"font":       enumAttribute("serif", "monospace"),
+	"size":       enumAttribute("small", "large", "huge"),
+	"color":      colourAttribute,
+	"background": colourAttribute,
+	"link":       linkAttribute,
+}
+
+// deltaImageAttributes contains attributes which are additionally allowed on image embeds.
+var deltaImageAttributes = map[string]attributeValidator{
+	"width":  imageSizeAttribute,
+	"height": imageSizeAttribute,
+	"alt":    stringAttribute,
+}
+
+// NormaliseDelta validates a Quill document and returns it in normalised form.
+// Documents containing unknown operations, attributes or embeds as well as unsafe links or images are rejected.
+// An empty string is returned unchanged, since it represents an empty document.
+func NormaliseDelta(data string) (string, error) {
+	if data == "" {
+		return "", nil
+	}
+
+	var raw struct {
+		Ops []map[string]json.RawMessage `json:"ops"`
+	}
+	dec := json.NewDecoder(strings.NewReader(data))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&raw)
+	if err != nil {
+		return "", fmt.Errorf("delta: can not parse: %w", err)
+	}
+	if dec.More() {
+		return "", errors.New("delta: trailing data")
+	}
+
+	d := delta{Ops: make([]deltaOp, 0, len(raw.Ops))}
+	for i := range raw.Ops {
+		op, err := parseDeltaOp(raw.Ops[i])
+		if err != nil {
+			return "", fmt.Errorf("delta: op %d: %w", i, err)
+		}
+		if s, ok := op.Insert.(string); ok && s == "" {
+			continue
+		}
+		if len(d.Ops) > 0 {
+			// Merge text inserts with the same attributes
+			last := &d.Ops[len(d.Ops)-1]
+			ls, lok := last.Insert.(string)
+			s, ok := op.Insert.(string)
+			if lok && ok && reflect.DeepEqual(last.Attributes, op.Attributes) {
+				last.Insert = strings.Join([]string{ls, s}, "")
+				continue
+			}
+		}
+		d.Ops = append(d.Ops, op)
+	}
+
+	// Quill documents always end with a newline.
+	// It is merged like any other insert, so normalising again does not change the document.
+	n := len(d.Ops)
+	last, ok := "", false
+	if n > 0 {
+		last, ok = d.Ops[n-1].Insert.(string)
+	}
+	switch {
+	case ok && strings.HasSuffix(last, "\n"):
+	case ok && d.Ops[n-1].Attributes == nil:
+		d.Ops[n-1].Insert = strings.Join([]string{last, "\n"}, "")
+	default:
+		d.Ops = append(d.Ops, deltaOp{Insert: "\n"})
+	}
+
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	err = enc.Encode(&d)
+	if err != nil {
+		return "", fmt.Errorf("delta: can not encode: %w", err)
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// equalDelta reports whether two Quill documents are equal, ignoring differences in their JSON encoding.
+func equalDelta(a, b string) bool {
+	if a == b {
+		return true
+	}
+	var da, db interface{}
+	if json.Unmarshal([]byte(a), &da) != nil || json.Unmarshal([]byte(b), &db) != nil {
+		return false
+	}
+	return reflect.DeepEqual(da, db)
+}
+
+func parseDeltaOp(raw map[string]json.RawMessage) (deltaOp, error) {
+	op := deltaOp{}
+	image := false
+
+	for k := range raw {
+		switch k {
+		case "insert", "attributes":
+		default:
+			return deltaOp{}, fmt.Errorf("unsupported operation '%s'", k)
+		}
+	}
+
+	insert, ok := raw["insert"]
+	if !ok {
+		return deltaOp{}, errors.New("no insert")
+	}
+	if bytes.Equal(bytes.TrimSpace(insert), []byte("null")) {
+		return deltaOp{}, errors.New("insert must be text or embed")
+	}
+	var s string
+	if err := json.Unmarshal(insert, &s); err == nil {
+		op.Insert = s
+	} else {
+		var embed map[string]json.RawMessage
+		if err := json.Unmarshal(insert, &embed); err != nil {
+			return deltaOp{}, errors.New("insert must be text or embed")
+		}
+		if len(embed) != 1 {
+			return deltaOp{}, errors.New("embed must have exactly one type")
+		}
+		for k, v := range embed {
+			var value string
+			if err := json.Unmarshal(v, &value); err != nil {
+				return deltaOp{}, fmt.Errorf("embed '%s' must be a string", k)
+			}
+			switch k {
+			case "image":
+				if err := validateImageSource(value); err != nil {
+					return deltaOp{}, err
+				}
+				image = true
+			case "formula":
+			default:
+				return deltaOp{}, fmt.Errorf("unsupported embed '%s'", k)
+			}
+			op.Insert = map[string]interface{}{k: value}
+		}
+	}
+
+	attributes, ok := raw["attributes"]
+	if !ok {
+		return op, nil
+	}
+	var a map[string]json.RawMessage
+	if err := json.Unmarshal(attributes, &a); err != nil {
+		return deltaOp{}, errors.New("attributes must be an object")
+	}
+	for k, v := range a {
+		if bytes.Equal(bytes.TrimSpace(v), []byte("null")) {
+			// Removed attribute
+			continue
+		}
+		validator, ok := deltaTextAttributes[k]
+		if !ok && image {
+			validator, ok = deltaImageAttributes[k]
+		}
+		if !ok {
+			return deltaOp{}, fmt.Errorf("unsupported attribute '%s'", k)
+		}
+		value, err := validator(v)
+		if err != nil {
+			return deltaOp{}, fmt.Errorf("attribute '%s': %w", k, err)
+		}
+		if op.Attributes == nil {
+			op.Attributes = make(map[string]interface{}, len(a))
+		}
+		op.Attributes[k] = value
+	}
+	return op, nil
+}
+
+func validateImageSource(src string) error {
+	if deltaDataImage.MatchString(src) {
+		return nil
+	}
+	if !config.AllowExternalImages {
+		return errors.New("only embedded images are allowed")
+	}
+	u, err := url.Parse(src)
+	if err != nil {
+		return fmt.Errorf("invalid image source: %w", err)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return nil
+	default:
+		return fmt.Errorf("image scheme '%s' not allowed", u.Scheme)
+	}
+}
+
+func boolAttribute(raw json.RawMessage) (interface{}, error) {
+	var b bool
+	if err := json.Unmarshal(raw, &b); err != nil {
+		return nil, errors.New("must be a boolean")
+	}
+	return b, nil
+}
+
+func stringAttribute(raw json.RawMessage) (interface{}, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, errors.New("must be a string")
+	}
+	return s, nil
+}
+
+func intAttribute(min, max int) attributeValidator {
+	return func(raw json.RawMessage) (interface{}, error) {
+		var i int
+		if err := json.Unmarshal(raw, &i); err != nil {
+			return nil, errors.New("must be an integer")
+		}
+		if i < min || i > max {
+			return nil, fmt.Errorf("must be between %d and %d", min, max)
+		}
+		return i, nil
+	}
+}
+
+func enumAttribute(values ...string) attributeValidator {
+	return func(raw json.RawMessage) (interface{}, error) {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, errors.New("must be a string")
+		}
+		for i := range values {
+			if s == values[i] {
+				return s, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown value '%s'", s)
+	}
+}
+
+func codeBlockAttribute(raw json.RawMessage) (interface{}, error) {
+	var b bool
+	if err := json.Unmarshal(raw, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil || !deltaCodeLanguage.MatchString(s) {
+		return nil, errors.New("must be a boolean or a language")
+	}
+	return s, nil
+}
+
+func colourAttribute(raw json.RawMessage) (interface{}, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, errors.New("must be a string")
+	}
+	if !deltaColour.MatchString(s) {
+		return nil, fmt.Errorf("invalid colour '%s'", s)
+	}
+	return s, nil
+}
+
+func imageSizeAttribute(raw json.RawMessage) (interface{}, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, errors.New("must be a string")
+	}
+	if !deltaImageSize.MatchString(s) {
+		return nil, fmt.Errorf("invalid size '%s'", s)
+	}
+	return s, nil
+}
+
+func linkAttribute(raw json.RawMessage) (interface{}, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, errors.New("must be a string")
+	}
+	// Browsers ignore surrounding whitespace, so it must not hide the scheme
+	s = strings.TrimSpace(s)
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid link: %w", err)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https", "mailto", "tel":
+		return s, nil
+	case "about":
+		// Quill replaces unsafe links with about:blank
+		if u.Opaque == "blank" {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("link scheme '%s' not allowed", u.Scheme)
+}
@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormaliseDelta(t *testing.T) {
+	testGlobals()
+
+	tests := []struct {
+		name           string
+		data           string
+		externalImages bool
+		want           string // empty if the document must be rejected
+	}{
+		{"empty", ``, false, ``},
+		{"no ops", `{"ops":[]}`, false, `{"ops":[{"insert":"\n"}]}`},
+		{"merged inserts", `{"ops":[{"insert":"a"},{"insert":"b"}]}`, false, `{"ops":[{"insert":"ab\n"}]}`},
+		{"removed attribute", `{"ops":[{"insert":"a","attributes":{"bold":null}},{"insert":"b\n"}]}`, false, `{"ops":[{"insert":"ab\n"}]}`},
+		{"attributes", `{"ops":[{"insert":"a","attributes":{"bold":true,"header":2}},{"insert":"\n"}]}`, false, `{"ops":[{"insert":"a","attributes":{"bold":true,"header":2}},{"insert":"\n"}]}`},
+		{"no HTML escaping", `{"ops":[{"insert":"<b>&</b>\n"}]}`, false, `{"ops":[{"insert":"<b>&</b>\n"}]}`},
+		{"http link", `{"ops":[{"insert":"a","attributes":{"link":"https://example.com"}},{"insert":"\n"}]}`, false, `{"ops":[{"insert":"a","attributes":{"link":"https://example.com"}},{"insert":"\n"}]}`},
+		{"relative link", `{"ops":[{"insert":"a","attributes":{"link":"/other"}},{"insert":"\n"}]}`, false, `{"ops":[{"insert":"a","attributes":{"link":"/other"}},{"insert":"\n"}]}`},
+		{"about:blank link", `{"ops":[{"insert":"a","attributes":{"link":"about:blank"}},{"insert":"\n"}]}`, false, `{"ops":[{"insert":"a","attributes":{"link":"about:blank"}},{"insert":"\n"}]}`},
+		{"javascript link", `{"ops":[{"insert":"a","attributes":{"link":"javascript:alert(1)"}},{"insert":"\n"}]}`, false, ``},
+		{"mixed-case javascript link", `{"ops":[{"insert":"a","attributes":{"link":"JaVaScRiPt:alert(1)"}},{"insert":"\n"}]}`, false, ``},
+		{"javascript link with whitespace", `{"ops":[{"insert":"a","attributes":{"link":"  javascript:alert(1)"}},{"insert":"\n"}]}`, false, ``},
+		{"data link", `{"ops":[{"insert":"a","attributes":{"link":"data:text/html,<script>alert(1)</script>"}},{"insert":"\n"}]}`, false, ``},
+		{"mixed-case data link", `{"ops":[{"insert":"a","attributes":{"link":"DATA:text/html;base64,PHNjcmlwdD4="}},{"insert":"\n"}]}`, false, ``},
+		{"about link", `{"ops":[{"insert":"a","attributes":{"link":"about:config"}},{"insert":"\n"}]}`, false, ``},
+		{"embedded image", `{"ops":[{"insert":{"image":"data:image/png;base64,iVBORw0KGgo="},"attributes":{"width":"100px"}},{"insert":"\n"}]}`, false, `{"ops":[{"insert":{"image":"data:image/png;base64,iVBORw0KGgo="},"attributes":{"width":"100px"}},{"insert":"\n"}]}`},
+		{"embedded SVG image", `{"ops":[{"insert":{"image":"data:image/svg+xml;base64,PHN2Zz4="}},{"insert":"\n"}]}`, true, ``},
+		{"external image", `{"ops":[{"insert":{"image":"https://example.com/a.png"}},{"insert":"\n"}]}`, false, ``},
+		{"allowed external image", `{"ops":[{"insert":{"image":"https://example.com/a.png"}},{"insert":"\n"}]}`, true, `{"ops":[{"insert":{"image":"https://example.com/a.png"}},{"insert":"\n"}]}`},
+		{"javascript image", `{"ops":[{"insert":{"image":"javascript:alert(1)"}},{"insert":"\n"}]}`, true, ``},
+		{"image attribute on text", `{"ops":[{"insert":"a","attributes":{"width":"100px"}},{"insert":"\n"}]}`, false, ``},
+		{"formula", `{"ops":[{"insert":{"formula":"x^2"}},{"insert":"\n"}]}`, false, `{"ops":[{"insert":{"formula":"x^2"}},{"insert":"\n"}]}`},
+		{"unknown embed", `{"ops":[{"insert":{"video":"https://example.com"}},{"insert":"\n"}]}`, false, ``},
+		{"two embed types", `{"ops":[{"insert":{"image":"data:image/png;base64,AA==","formula":"x"}},{"insert":"\n"}]}`, false, ``},
+		{"delete op", `{"ops":[{"delete":1}]}`, false, ``},
+		{"retain op", `{"ops":[{"retain":1,"insert":"a\n"}]}`, false, ``},
+		{"missing insert", `{"ops":[{"attributes":{"bold":true}}]}`, false, ``},
+		{"unknown attribute", `{"ops":[{"insert":"a","attributes":{"onclick":"alert(1)"}},{"insert":"\n"}]}`, false, ``},
+		{"invalid attribute value", `{"ops":[{"insert":"a","attributes":{"header":7}},{"insert":"\n"}]}`, false, ``},
+		{"invalid colour", `{"ops":[{"insert":"a","attributes":{"color":"red;background:url(x)"}},{"insert":"\n"}]}`, false, ``},
+		{"number insert", `{"ops":[{"insert":1}]}`, false, ``},
+		{"array insert", `{"ops":[{"insert":["a"]}]}`, false, ``},
+		{"null insert", `{"ops":[{"insert":null}]}`, false, ``},
+		{"non-string embed", `{"ops":[{"insert":{"image":1}},{"insert":"\n"}]}`, false, ``},
+		{"unknown field", `{"ops":[],"other":1}`, false, ``},
+		{"trailing data", `{"ops":[]}{"ops":[]}`, false, ``},
+		{"no JSON", `ops`, false, ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := config.AllowExternalImages
+			config.AllowExternalImages = tt.externalImages
+			defer func() { config.AllowExternalImages = old }()
+
+			got, err := NormaliseDelta(tt.data)
+			if tt.want == "" && tt.data != "" {
+				if err == nil {
+					t.Errorf("document accepted: %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+			// The normalised form must not change when normalised again
+			again, err := NormaliseDelta(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again != got {
+				t.Errorf("normalising again gives %s", again)
+			}
+		})
+	}
+}
+
+func TestOversizedDocument(t *testing.T) {
+	s, w := testWriter(t)
+	conn := dialWriter(t, s, "")
+	defer conn.Close()
+	readCommands(t, conn, 2)
+
+	err := conn.WriteJSON(command{Comm: commandAskWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := readCommands(t, conn, 1)[0]; c.Comm != commandGetWrite {
+		t.Fatalf("got %s, want %s", c.Comm, commandGetWrite)
+	}
+
+	data := strings.Join([]string{`{"ops":[{"insert":"`, strings.Repeat("a", config.MaxDocumentBytes), `\n"}]}`}, "")
+	err = conn.WriteJSON(command{Comm: commandInitialSend, Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := readCommands(t, conn, 1)[0]; c.Comm != commandError || c.Data != errorDocumentTooLarge {
+		t.Fatalf("got %+v, want error %s", c, errorDocumentTooLarge)
+	}
+
+	w.currentL.Lock()
+	defer w.currentL.Unlock()
+	if w.current != "" {
+		t.Errorf("oversized document was accepted (%d bytes)", len(w.current))
+	}
+}
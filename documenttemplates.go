@@ -0,0 +1,173 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// TemplateConfig describes a template for new documents.
+type TemplateConfig struct {
+	Name   string            // name used in templateParameter, e.g. "meeting"
+	File   string            // Quill document (delta) or Markdown file ending in ".md", translated files are used like for PathImpressum
+	Title  string            // title of the template
+	Titles map[string]string // titles in other languages (language -> title), optional
+}
+
+// title returns the title of the template in the language of the translation.
+func (c TemplateConfig) title(t Translation) string {
+	if title := c.Titles[t.Language]; title != "" {
+		return title
+	}
+	return c.Title
+}
+
+// templateParameter is the query parameter to create a document from a template.
+const templateParameter = "template"
+
+// templateName restricts the names of templates, so they can be used in URLs as they are.
+var templateName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// templateOption represents an entry of the list of templates.
+type templateOption struct {
+	Name  string
+	Title string
+}
+
+var (
+	documentTemplateList  []TemplateConfig
+	documentTemplates     = make(map[string]map[string]string) // name -> language -> document
+	documentTemplatesLock sync.RWMutex
+)
+
+// validateTemplates checks the configured templates.
+func validateTemplates(templates []TemplateConfig) error {
+	seen := make(map[string]bool)
+	for _, t := range templates {
+		if !templateName.MatchString(t.Name) {
+			return fmt.Errorf("invalid name '%s' of template (must only contain letters, digits, '-' and '_')", t.Name)
+		}
+		if seen[t.Name] {
+			return fmt.Errorf("name '%s' of template is already used", t.Name)
+		}
+		seen[t.Name] = true
+		if t.File == "" || t.Title == "" {
+			return fmt.Errorf("template '%s' needs a File and a Title", t.Name)
+		}
+	}
+	return nil
+}
+
+// loadDocumentTemplates reads all templates in all available languages.
+// Markdown files are converted to Quill documents. All templates are validated like documents sent by clients.
+// The templates are only replaced if all can be read.
+func loadDocumentTemplates(templates []TemplateConfig) error {
+	loaded := make(map[string]map[string]string, len(templates))
+	for _, t := range templates {
+		loaded[t.Name] = make(map[string]string)
+		for _, l := range AvailableLanguages() {
+			path := localisedPath(t.File, l)
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("template '%s': %w", t.Name, err)
+			}
+			var document string
+			if strings.EqualFold(filepath.Ext(path), ".md") {
+				document, err = MarkdownDelta(b)
+			} else {
+				document, err = NormaliseDelta(string(b))
+			}
+			if err != nil {
+				return fmt.Errorf("template '%s' (%s): %w", t.Name, path, err)
+			}
+			if len(document) > config.MaxDocumentBytes {
+				return fmt.Errorf("template '%s' (%s) is larger than MaxDocumentBytes", t.Name, path)
+			}
+			loaded[t.Name][l] = document
+		}
+	}
+
+	documentTemplatesLock.Lock()
+	defer documentTemplatesLock.Unlock()
+	documentTemplateList = templates
+	documentTemplates = loaded
+	return nil
+}
+
+// hasDocumentTemplates reports whether templates are configured.
+func hasDocumentTemplates() bool {
+	documentTemplatesLock.RLock()
+	defer documentTemplatesLock.RUnlock()
+	return len(documentTemplateList) != 0
+}
+
+// documentTemplate returns the template in the language.
+// If the template is not available in the language, the template of the default language is returned.
+func documentTemplate(name, language string) (string, bool) {
+	documentTemplatesLock.RLock()
+	defer documentTemplatesLock.RUnlock()
+	t, ok := documentTemplates[name]
+	if !ok {
+		return "", false
+	}
+	document, ok := t[language]
+	if !ok {
+		document, ok = t[GetDefaultTranslation().Language]
+	}
+	return document, ok
+}
+
+// templateOptions returns all templates users can choose from.
+func templateOptions(t Translation) []templateOption {
+	documentTemplatesLock.RLock()
+	defer documentTemplatesLock.RUnlock()
+	options := make([]templateOption, 0, len(documentTemplateList))
+	for _, c := range documentTemplateList {
+		options = append(options, templateOption{Name: c.Name, Title: c.title(t)})
+	}
+	return options
+}
+
+// applyTemplate fills the document with the template if it is still empty.
+// user is the user creating the document.
+func (w *writer) applyTemplate(name, language, user string) {
+	document, ok := documentTemplate(name, language)
+	if !ok {
+		log.Println(w.Key, "unknown template:", name)
+		return
+	}
+
+	w.currentL.Lock()
+	if w.current != "" || w.revision != 0 {
+		// The document already exists
+		w.currentL.Unlock()
+		return
+	}
+	w.revision++
+	w.current = document
+	w.editors[user] = true
+	revision := w.revision
+	w.currentL.Unlock()
+
+	w.publish(busMessage{Type: busState, Data: document, Revision: revision})
+	log.Println(w.Key, "created from template:", name)
+}
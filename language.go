@@ -0,0 +1,149 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// languageParameter is the query parameter to choose the language of the user interface.
+const languageParameter = "lang"
+
+// languageCookie stores the language chosen through languageParameter.
+const languageCookie = "writergo_lang"
+
+// languageCookieAge is the time the chosen language is remembered.
+const languageCookieAge = 365 * 24 * time.Hour
+
+// languageOption represents an entry of the language switcher.
+type languageOption struct {
+	Code string
+	Name string
+}
+
+// languageOptions returns all languages users can choose from.
+func languageOptions() []languageOption {
+	languages := AvailableLanguages()
+	options := make([]languageOption, 0, len(languages))
+	for _, l := range languages {
+		t, ok := GetLoadedTranslation(l)
+		if !ok {
+			continue
+		}
+		name := t.LanguageName
+		if name == "" {
+			name = l
+		}
+		options = append(options, languageOption{Code: l, Name: name})
+	}
+	return options
+}
+
+// requestLanguage returns the language of the user interface for the request.
+// The language is chosen through languageParameter, languageCookie, the Accept-Language header and finally the default language.
+// A language chosen through languageParameter is remembered in languageCookie.
+func requestLanguage(rw http.ResponseWriter, r *http.Request) string {
+	rw.Header().Add("Vary", "Accept-Language, Cookie")
+
+	if l := r.URL.Query().Get(languageParameter); l != "" {
+		if _, ok := GetLoadedTranslation(l); ok {
+			http.SetCookie(rw, &http.Cookie{
+				Name:     languageCookie,
+				Value:    l,
+				Path:     rootPath,
+				MaxAge:   int(languageCookieAge.Seconds()),
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteLaxMode,
+			})
+			return l
+		}
+	}
+
+	if c, err := r.Cookie(languageCookie); err == nil {
+		if _, ok := GetLoadedTranslation(c.Value); ok {
+			return c.Value
+		}
+	}
+
+	if l := negotiateLanguage(r.Header.Get("Accept-Language")); l != "" {
+		return l
+	}
+	return GetDefaultTranslation().Language
+}
+
+// requestTranslation returns the translation of the user interface for the request, see requestLanguage.
+func requestTranslation(rw http.ResponseWriter, r *http.Request) Translation {
+	t, ok := GetLoadedTranslation(requestLanguage(rw, r))
+	if !ok {
+		return GetDefaultTranslation()
+	}
+	return t
+}
+
+// negotiateLanguage returns the available language the user prefers most according to an Accept-Language header.
+// Regional variants (e.g. "de-AT") match the language ("de"). If no language matches, the empty string is returned.
+func negotiateLanguage(header string) string {
+	type preference struct {
+		tag string
+		q   float64
+	}
+
+	var preferences []preference
+	for _, entry := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(entry, ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		for _, p := range strings.Split(params, ";") {
+			v, ok := strings.CutPrefix(strings.TrimSpace(p), "q=")
+			if !ok {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err == nil {
+				q = parsed
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		preferences = append(preferences, preference{tag, q})
+	}
+	sort.SliceStable(preferences, func(i, j int) bool { return preferences[i].q > preferences[j].q })
+
+	// Language tags are case insensitive
+	available := make(map[string]string)
+	for _, l := range AvailableLanguages() {
+		available[strings.ToLower(l)] = l
+	}
+	for _, p := range preferences {
+		if l, ok := available[p.tag]; ok {
+			return l
+		}
+		primary, _, _ := strings.Cut(p.tag, "-")
+		if l, ok := available[primary]; ok {
+			return l
+		}
+	}
+	return ""
+}
@@ -16,6 +16,8 @@
 package main
 
 import (
+	"bytes"
+	"compress/flate"
 	"encoding/json"
 	"errors"
 	"flag"
@@ -27,37 +29,132 @@ import (
 	"strings"
 	"syscall"
 
+	_ "github.com/Top-Ranger/writergo/audit"
+	"github.com/Top-Ranger/writergo/auth"
+	_ "github.com/Top-Ranger/writergo/bus"
 	_ "github.com/Top-Ranger/writergo/datasafe"
 	"github.com/Top-Ranger/writergo/registry"
 )
 
 // ConfigStruct contains all configuration options for PollGo!
 type ConfigStruct struct {
-	Language       string
-	Address        string
-	PathImpressum  string
-	PathDSGVO      string
-	SyncSeconds    int
-	GCMinutes      int
-	ServerPath     string
-	DataSafe       string
-	DataSafeConfig string
+	Language                      string
+	TranslationDirectory          string
+	Address                       string
+	PathImpressum                 string
+	PathDSGVO                     string
+	Pages                         []PageConfig
+	PagesReloadSeconds            int
+	Templates                     []TemplateConfig
+	LandingPage                   bool
+	CookieSecret                  string `secret:"all"`
+	SyncSeconds                   int
+	GCMinutes                     int
+	ResumeGraceSeconds            int
+	ShutdownTimeoutSeconds        int
+	SendQueueSize                 int
+	SendQueueOverflow             string
+	MaxMessageBytes               int64
+	MaxDocumentBytes              int
+	MaxOpenDocuments              int
+	RateLimitDocumentsPerMinute   int
+	RateLimitConnectionsPerMinute int
+	RateLimitMessagesPerSecond    int
+	AllowExternalImages           bool
+	AllowedOrigins                []string
+	TrustedProxies                []string
+	Compression                   bool
+	CompressionLevel              int
+	CompressionThresholdBytes     int
+	ClusterInstance               string
+	ClusterLeaseSeconds           int
+	Authenticator                 string
+	AuthenticatorConfig           pluginConfig `secret:"true"`
+	DefaultRole                   string
+	Admins                        []string
+	AuditSink                     string
+	AuditSinkConfig               pluginConfig `secret:"true"`
+	Bus                           string
+	BusConfig                     pluginConfig `secret:"true"`
+	ServerPath                    string
+	DataSafe                      string
+	DataSafeConfig                pluginConfig `secret:"true"`
 }
 
+// pluginConfig is the configuration of a plug-in.
+// It can either be a JSON string, whose content is passed to the plug-in, or a JSON object, which is passed as is.
+type pluginConfig []byte
+
+func (p *pluginConfig) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	switch {
+	case bytes.Equal(b, []byte("null")):
+		*p = nil
+	case bytes.HasPrefix(b, []byte("{")):
+		*p = append(pluginConfig(nil), b...)
+	default:
+		var s string
+		err := json.Unmarshal(b, &s)
+		if err != nil {
+			return errors.New("plug-in configuration must be a string or an object")
+		}
+		*p = pluginConfig(s)
+	}
+	return nil
+}
+
+func (p pluginConfig) MarshalJSON() ([]byte, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(p), []byte("{")) && json.Valid(p) {
+		return []byte(p), nil
+	}
+	// HTML is escaped by the caller if needed
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	err := enc.Encode(string(p))
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), err
+}
+
+// minSendQueueSize is the minimal queue size needed to resync a connection.
+const minSendQueueSize = 4
+
+const defaultSendQueueSize = 64
+
+const defaultClusterLeaseSeconds = 30
+
+const (
+	defaultMaxMessageBytes  = 16 << 20
+	defaultMaxDocumentBytes = 8 << 20
+)
+
 var config ConfigStruct
 var ds registry.DataSafe
 
-func loadConfig(path string) (ConfigStruct, error) {
-	log.Printf("main: Loading config (%s)", path)
-	b, err := os.ReadFile(path)
-	if err != nil {
-		return ConfigStruct{}, errors.New(fmt.Sprintln("Can not read config.json:", err))
+// loadConfig loads the config in layers: defaults, the config file, environment variables and flags.
+// Later layers override earlier ones. An empty path skips the config file.
+func loadConfig(path string, flags map[string]string) (ConfigStruct, error) {
+	c := defaultConfig()
+
+	if path != "" {
+		log.Printf("main: Loading config (%s)", path)
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return ConfigStruct{}, errors.New(fmt.Sprintln("Can not read config.json:", err))
+		}
+
+		err = json.Unmarshal(b, &c)
+		if err != nil {
+			return ConfigStruct{}, errors.New(fmt.Sprintln("Error while parsing config.json:", err))
+		}
 	}
 
-	c := ConfigStruct{}
-	err = json.Unmarshal(b, &c)
+	err := applyConfigEnv(&c)
 	if err != nil {
-		return ConfigStruct{}, errors.New(fmt.Sprintln("Error while parsing config.json:", err))
+		return ConfigStruct{}, err
+	}
+	err = applyConfigFlags(&c, flags)
+	if err != nil {
+		return ConfigStruct{}, err
 	}
 
 	if !strings.HasPrefix(c.ServerPath, "/") && c.ServerPath != "" {
@@ -66,6 +163,68 @@ func loadConfig(path string) (ConfigStruct, error) {
 	}
 	c.ServerPath = strings.TrimSuffix(c.ServerPath, "/")
 
+	if c.SendQueueSize < minSendQueueSize {
+		log.Printf("load config: SendQueueSize must be at least %d, using %d", minSendQueueSize, defaultSendQueueSize)
+		c.SendQueueSize = defaultSendQueueSize
+	}
+
+	if c.ResumeGraceSeconds < 0 {
+		return ConfigStruct{}, fmt.Errorf("ResumeGraceSeconds must not be negative, got %d", c.ResumeGraceSeconds)
+	}
+
+	if c.MaxMessageBytes <= 0 {
+		log.Printf("load config: MaxMessageBytes not set, using %d", defaultMaxMessageBytes)
+		c.MaxMessageBytes = defaultMaxMessageBytes
+	}
+	if c.MaxDocumentBytes <= 0 {
+		log.Printf("load config: MaxDocumentBytes not set, using %d", defaultMaxDocumentBytes)
+		c.MaxDocumentBytes = defaultMaxDocumentBytes
+	}
+	if int64(c.MaxDocumentBytes) >= c.MaxMessageBytes {
+		log.Println("load config: MaxDocumentBytes should be smaller than MaxMessageBytes, documents close to the limit can not be sent")
+	}
+
+	for i := range c.AllowedOrigins {
+		c.AllowedOrigins[i] = strings.ToLower(strings.TrimSuffix(c.AllowedOrigins[i], "/"))
+	}
+
+	if c.CompressionLevel < flate.HuffmanOnly || c.CompressionLevel > flate.BestCompression {
+		return ConfigStruct{}, fmt.Errorf("CompressionLevel must be between %d and %d", flate.HuffmanOnly, flate.BestCompression)
+	}
+
+	c.ClusterInstance = strings.TrimSuffix(c.ClusterInstance, "/")
+	if c.ClusterInstance != "" && c.ClusterLeaseSeconds < 3 {
+		log.Printf("load config: ClusterLeaseSeconds must be at least 3, using %d", defaultClusterLeaseSeconds)
+		c.ClusterLeaseSeconds = defaultClusterLeaseSeconds
+	}
+
+	err = validatePages(c.Pages)
+	if err != nil {
+		return ConfigStruct{}, fmt.Errorf("invalid Pages: %w", err)
+	}
+	_, err = auth.ParseNetworks(c.TrustedProxies)
+	if err != nil {
+		return ConfigStruct{}, fmt.Errorf("invalid TrustedProxies: %w", err)
+	}
+	err = validateTemplates(c.Templates)
+	if err != nil {
+		return ConfigStruct{}, fmt.Errorf("invalid Templates: %w", err)
+	}
+
+	switch c.DefaultRole {
+	case roleNone, roleViewer, roleCommenter, roleEditor:
+	default:
+		return ConfigStruct{}, fmt.Errorf("unknown DefaultRole '%s' (must be '%s', '%s', '%s' or '%s')", c.DefaultRole, roleNone, roleViewer, roleCommenter, roleEditor)
+	}
+
+	switch c.SendQueueOverflow {
+	case "":
+		c.SendQueueOverflow = overflowResync
+	case overflowResync, overflowDisconnect:
+	default:
+		return ConfigStruct{}, fmt.Errorf("unknown SendQueueOverflow '%s' (must be '%s' or '%s')", c.SendQueueOverflow, overflowResync, overflowDisconnect)
+	}
+
 	return c, nil
 }
 
@@ -94,18 +253,47 @@ func printInfo() {
 	}
 }
 
+// relayouter is implemented by DataSafes which can move stored writers to a new layout.
+type relayouter interface {
+	Relayout() error
+}
+
 func main() {
 	printInfo()
 
-	configPath := flag.String("config", "./config.json", "Path to json config for WriterGo!")
+	configPath := flag.String("config", "./config.json", "Path to json config for WriterGo! (empty to only use environment and flags)")
+	relayout := flag.Bool("relayout", false, "Move all stored writers to the layout configured for the DataSafe and exit")
+	printConfigFlag := flag.Bool("print-config", false, "Print the effective config with secrets redacted and exit")
+	translationReportFlag := flag.Bool("translation-report", false, "Print missing and unknown strings of all translations and exit")
+	createTokenFlag := flag.String("create-token", "", "Create an API token acting as the given user, print it and exit")
+	tokenScopes := flag.String("token-scopes", scopeRead, "Comma separated scopes of the token created through -create-token (read, write, admin)")
+	listTokens := flag.Bool("list-tokens", false, "List all API tokens and exit")
+	revokeToken := flag.String("revoke-token", "", "Revoke the API token with the given ID and exit")
+	configOverrides := configFlags(flag.CommandLine)
 	flag.Parse()
 
-	c, err := loadConfig(*configPath)
+	c, err := loadConfig(*configPath, configOverrides)
 	if err != nil {
 		panic(err)
 	}
 	config = c
 
+	if *printConfigFlag {
+		err = printConfig(os.Stdout, config)
+		if err != nil {
+			log.Panicln("main: Can not print config:", err)
+		}
+		return
+	}
+
+	if *translationReportFlag {
+		err = translationReport(os.Stdout, config.TranslationDirectory)
+		if err != nil {
+			log.Panicln("main: Can not create translation report:", err)
+		}
+		return
+	}
+
 	log.Printf("main: Using DataSafe '%s'", config.DataSafe)
 	var found bool
 	ds, found = registry.GetDataSafe(config.DataSafe)
@@ -113,9 +301,79 @@ func main() {
 		log.Panicln("unknown data safe", config.DataSafe)
 	}
 
-	err = ds.LoadConfig([]byte(config.DataSafeConfig))
+	err = ds.LoadConfig(config.DataSafeConfig)
 	if err != nil {
-		panic(err)
+		log.Panicf("main: Can not load DataSafe '%s': %s", config.DataSafe, err.Error())
+	}
+
+	if *relayout {
+		r, ok := ds.(relayouter)
+		if !ok {
+			log.Panicf("main: DataSafe '%s' does not support relayout", config.DataSafe)
+		}
+		err = r.Relayout()
+		ds.FlushAndClose()
+		if err != nil {
+			log.Panicln("main: Can not relayout:", err)
+		}
+		return
+	}
+
+	tokenStore, _ = ds.(registry.TokenStore)
+	if *createTokenFlag != "" || *listTokens || *revokeToken != "" {
+		err = runTokenCommand(os.Stdout, *createTokenFlag, *tokenScopes, *listTokens, *revokeToken)
+		ds.FlushAndClose()
+		if err != nil {
+			log.Panicln("main: Can not manage API tokens:", err)
+		}
+		return
+	}
+
+	log.Printf("main: Using Authenticator '%s'", config.Authenticator)
+	authenticator, found = registry.GetAuthenticator(config.Authenticator)
+	if !found {
+		log.Panicln("unknown authenticator", config.Authenticator)
+	}
+
+	if r, ok := authenticator.(registry.ServerPathReceiver); ok {
+		r.SetServerPath(config.ServerPath)
+	}
+	err = authenticator.LoadConfig(config.AuthenticatorConfig)
+	if err != nil {
+		log.Panicf("main: Can not load Authenticator '%s': %s", config.Authenticator, err.Error())
+	}
+
+	log.Printf("main: Using AuditSink '%s'", config.AuditSink)
+	auditSink, found = registry.GetAuditSink(config.AuditSink)
+	if !found {
+		log.Panicln("unknown audit sink", config.AuditSink)
+	}
+
+	err = auditSink.LoadConfig(config.AuditSinkConfig)
+	if err != nil {
+		log.Panicf("main: Can not load AuditSink '%s': %s", config.AuditSink, err.Error())
+	}
+	startAudit()
+
+	log.Printf("main: Using Bus '%s'", config.Bus)
+	messageBus, found = registry.GetBus(config.Bus)
+	if !found {
+		log.Panicln("unknown bus", config.Bus)
+	}
+
+	err = messageBus.LoadConfig(config.BusConfig)
+	if err != nil {
+		log.Panicf("main: Can not load Bus '%s': %s", config.Bus, err.Error())
+	}
+
+	err = initialiseCluster()
+	if err != nil {
+		log.Panicln("main: Can not initialise cluster:", err)
+	}
+
+	err = LoadTranslations(config.TranslationDirectory)
+	if err != nil {
+		log.Panicln("main: Can not load translations:", err)
 	}
 
 	err = SetDefaultTranslation(config.Language)
@@ -124,15 +382,26 @@ func main() {
 	}
 	log.Printf("main: Setting language to '%s'", config.Language)
 
+	err = initialiseRateLimits()
+	if err != nil {
+		log.Panicln("main: Can not initialise rate limits:", err)
+	}
 	RunServer()
 
 	s := make(chan os.Signal, 1)
-	signal.Notify(s, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(s, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
 
 	log.Println("main: waiting")
 
-	for range s {
+	for sig := range s {
+		if sig == syscall.SIGHUP {
+			reloadConfig(*configPath, configOverrides)
+			continue
+		}
+
 		StopServer()
+		stopAudit()
+		messageBus.Close()
 		ds.FlushAndClose()
 		return
 	}
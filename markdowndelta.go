@@ -0,0 +1,210 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// deltaBuilder collects the operations of a Quill document while walking a Markdown document.
+type deltaBuilder struct {
+	source []byte
+	ops    []deltaOp
+}
+
+// MarkdownDelta converts a Markdown document to a Quill document.
+// Elements without a representation in Quill (e.g. raw HTML) are dropped, tables are converted to lines of text.
+// The result is normalised and validated like documents sent by clients.
+func MarkdownDelta(b []byte) (string, error) {
+	md := goldmark.New(goldmark.WithExtensions(extension.GFM))
+	doc := md.Parser().Parse(text.NewReader(b))
+
+	d := &deltaBuilder{source: b}
+	d.blocks(doc, nil)
+
+	raw, err := json.Marshal(delta{Ops: d.ops})
+	if err != nil {
+		return "", err
+	}
+	return NormaliseDelta(string(raw))
+}
+
+// insert adds text or an embed with the given attributes.
+func (d *deltaBuilder) insert(insert interface{}, attributes map[string]interface{}) {
+	op := deltaOp{Insert: insert}
+	if len(attributes) != 0 {
+		op.Attributes = make(map[string]interface{}, len(attributes))
+		for k, v := range attributes {
+			op.Attributes[k] = v
+		}
+	}
+	d.ops = append(d.ops, op)
+}
+
+// line ends the current line. In Quill, the attributes of a line (e.g. headers) are set on its newline.
+func (d *deltaBuilder) line(attributes map[string]interface{}) {
+	d.insert("\n", attributes)
+}
+
+// with returns a copy of the attributes with the value added.
+func with(attributes map[string]interface{}, key string, value interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(attributes)+1)
+	for k, v := range attributes {
+		c[k] = v
+	}
+	c[key] = value
+	return c
+}
+
+// blocks converts all block children of the node. line contains the attributes of all lines of the children.
+func (d *deltaBuilder) blocks(n ast.Node, line map[string]interface{}) {
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		switch c := c.(type) {
+		case *ast.Heading:
+			d.inlines(c, nil, line)
+			d.line(with(line, "header", c.Level))
+		case *ast.Paragraph, *ast.TextBlock:
+			d.inlines(c, nil, line)
+			d.line(line)
+		case *ast.Blockquote:
+			d.blocks(c, with(line, "blockquote", true))
+		case *ast.List:
+			d.list(c, line)
+		case *ast.FencedCodeBlock, *ast.CodeBlock:
+			var code interface{} = true
+			if f, ok := c.(*ast.FencedCodeBlock); ok {
+				if l := string(f.Language(d.source)); deltaCodeLanguage.MatchString(l) {
+					code = l
+				}
+			}
+			lines := c.Lines()
+			for i := 0; i < lines.Len(); i++ {
+				s := lines.At(i)
+				d.insert(strings.TrimSuffix(string(s.Value(d.source)), "\n"), nil)
+				d.line(with(line, "code-block", code))
+			}
+		case *extast.Table:
+			for row := c.FirstChild(); row != nil; row = row.NextSibling() {
+				for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+					if cell != row.FirstChild() {
+						d.insert(" | ", nil)
+					}
+					attributes := map[string]interface{}(nil)
+					if row.Kind() == extast.KindTableHeader {
+						attributes = map[string]interface{}{"bold": true}
+					}
+					d.inlines(cell, attributes, line)
+				}
+				d.line(line)
+			}
+		default:
+			// Thematic breaks and raw HTML have no representation
+		}
+	}
+}
+
+// list converts a list. Nested lists are indented.
+func (d *deltaBuilder) list(l *ast.List, line map[string]interface{}) {
+	kind := "bullet"
+	if l.IsOrdered() {
+		kind = "ordered"
+	}
+	if _, ok := line["list"]; ok {
+		indent, _ := line["indent"].(int)
+		line = with(line, "indent", indent+1)
+	}
+	line = with(line, "list", kind)
+
+	for item := l.FirstChild(); item != nil; item = item.NextSibling() {
+		itemLine := line
+		if block := item.FirstChild(); block != nil {
+			if box, ok := block.FirstChild().(*extast.TaskCheckBox); ok {
+				itemLine = with(line, "list", "unchecked")
+				if box.IsChecked {
+					itemLine["list"] = "checked"
+				}
+			}
+		}
+		d.blocks(item, itemLine)
+	}
+}
+
+// inlines converts all inline children of the node. Hard line breaks end the line with the attributes of line.
+func (d *deltaBuilder) inlines(n ast.Node, attributes, line map[string]interface{}) {
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		switch c := c.(type) {
+		case *ast.Text:
+			d.insert(string(c.Value(d.source)), attributes)
+			switch {
+			case c.HardLineBreak():
+				d.line(line)
+			case c.SoftLineBreak():
+				d.insert(" ", attributes)
+			}
+		case *ast.String:
+			d.insert(string(c.Value), attributes)
+		case *ast.CodeSpan:
+			d.inlines(c, with(attributes, "code", true), line)
+		case *ast.Emphasis:
+			style := "italic"
+			if c.Level >= 2 {
+				style = "bold"
+			}
+			d.inlines(c, with(attributes, style, true), line)
+		case *extast.Strikethrough:
+			d.inlines(c, with(attributes, "strike", true), line)
+		case *ast.Link:
+			d.inlines(c, with(attributes, "link", string(c.Destination)), line)
+		case *ast.AutoLink:
+			u := string(c.URL(d.source))
+			if c.AutoLinkType == ast.AutoLinkEmail && !strings.HasPrefix(strings.ToLower(u), "mailto:") {
+				u = strings.Join([]string{"mailto:", u}, "")
+			}
+			d.insert(string(c.Label(d.source)), with(attributes, "link", u))
+		case *ast.Image:
+			image := make(map[string]interface{})
+			if alt := d.plain(c); alt != "" {
+				image["alt"] = alt
+			}
+			d.insert(map[string]interface{}{"image": string(c.Destination)}, image)
+		default:
+			// Raw HTML and task check boxes have no representation as text
+		}
+	}
+}
+
+// plain returns the text of all inline children of the node without formatting.
+func (d *deltaBuilder) plain(n ast.Node) string {
+	var b strings.Builder
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		switch c := c.(type) {
+		case *ast.Text:
+			b.Write(c.Value(d.source))
+		case *ast.String:
+			b.Write(c.Value)
+		default:
+			b.WriteString(d.plain(c))
+		}
+	}
+	return b.String()
+}
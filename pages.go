@@ -0,0 +1,253 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PageConfig describes an additional page rendered from a Markdown file.
+type PageConfig struct {
+	Path       string            // path of the page below ServerPath, e.g. "terms.html"
+	File       string            // Markdown file, translated files are used like for PathImpressum
+	Title      string            // title of the page
+	Titles     map[string]string // titles in other languages (language -> title), optional
+	FooterLink bool              // whether the footer links to the page
+}
+
+// textPage is a page served from a Markdown file.
+type textPage struct {
+	PageConfig
+	translatedTitle func(Translation) string // title taken from the translation instead of Title, optional
+}
+
+// title returns the title of the page in the language of the translation.
+func (p textPage) title(t Translation) string {
+	if p.translatedTitle != nil {
+		return p.translatedTitle(t)
+	}
+	if title := p.Titles[t.Language]; title != "" {
+		return title
+	}
+	return p.Title
+}
+
+// footerLink represents a link to a text page in the footer.
+type footerLink struct {
+	Path  string
+	Title string
+}
+
+// builtinPagePaths are the paths of the pages which are always served.
+var builtinPagePaths = map[string]bool{
+	"impressum.html": true,
+	"dsgvo.html":     true,
+}
+
+var (
+	textPageList         []textPage
+	textPages            = make(map[string]map[string][]byte) // page path -> language -> rendered page
+	textPagesFingerprint string
+	textPagesLock        sync.RWMutex
+	stopPagesReload      = make(chan struct{})
+)
+
+// builtinPages returns the legal notice and the privacy policy.
+func builtinPages(pathDSGVO, pathImpressum string) []textPage {
+	return []textPage{
+		{PageConfig{Path: "impressum.html", File: pathImpressum, FooterLink: true}, func(t Translation) string { return t.Impressum }},
+		{PageConfig{Path: "dsgvo.html", File: pathDSGVO, FooterLink: true}, func(t Translation) string { return t.PrivacyPolicy }},
+	}
+}
+
+// validatePages checks the configured pages and removes leading slashes from their paths.
+func validatePages(pages []PageConfig) error {
+	seen := make(map[string]bool)
+	for i := range pages {
+		p := &pages[i]
+		p.Path = strings.TrimPrefix(p.Path, "/")
+		if p.Path == "" || strings.Contains(p.Path, "/") || strings.HasPrefix(p.Path, reservedKeyPrefix) {
+			return fmt.Errorf("invalid path '%s' of page (must not be empty or contain '/' or start with '%s')", p.Path, reservedKeyPrefix)
+		}
+		if builtinPagePaths[p.Path] || seen[p.Path] || p.Path == "robots.txt" || p.Path == "favicon.ico" {
+			return fmt.Errorf("path '%s' of page is already used", p.Path)
+		}
+		seen[p.Path] = true
+		if p.File == "" || p.Title == "" {
+			return fmt.Errorf("page '%s' needs a File and a Title", p.Path)
+		}
+	}
+	return nil
+}
+
+// loadTextPages renders the legal notice, the privacy policy and all additional pages in all available languages.
+// For each language, a file with the language before the extension (e.g. "impressum.de.md") is preferred if it exists.
+// The pages are only replaced if all can be rendered.
+func loadTextPages(pathDSGVO, pathImpressum string, custom []PageConfig) error {
+	list := builtinPages(pathDSGVO, pathImpressum)
+	for i := range custom {
+		list = append(list, textPage{PageConfig: custom[i]})
+	}
+
+	// Files changing while rendering are detected by the next check
+	fingerprint := pagesFingerprint(list)
+
+	options := languageOptions()
+	pages := make(map[string]map[string][]byte, len(list))
+	for _, p := range list {
+		pages[p.Path] = make(map[string][]byte)
+		for _, l := range AvailableLanguages() {
+			t, ok := GetLoadedTranslation(l)
+			if !ok {
+				continue
+			}
+			b, err := os.ReadFile(localisedPath(p.File, l))
+			if err != nil {
+				return err
+			}
+			text := textTemplateStruct{Format(b), p.title(t), t, options, footerLinksOf(list, t), config.ServerPath}
+			output := bytes.NewBuffer(make([]byte, 0, len(text.Text)*2))
+			err = textTemplate.Execute(output, text)
+			if err != nil {
+				return err
+			}
+			pages[p.Path][l] = output.Bytes()
+		}
+	}
+
+	textPagesLock.Lock()
+	defer textPagesLock.Unlock()
+	textPageList = list
+	textPages = pages
+	textPagesFingerprint = fingerprint
+	return nil
+}
+
+// localisedPath returns the path of the file for the language if it exists (e.g. "impressum.de.md" for "impressum.md").
+// Otherwise path is returned.
+func localisedPath(path, language string) string {
+	ext := filepath.Ext(path)
+	localised := strings.Join([]string{strings.TrimSuffix(path, ext), ".", language, ext}, "")
+	if _, err := os.Stat(localised); err == nil {
+		return localised
+	}
+	return path
+}
+
+// pagesFingerprint returns a string which changes whenever a file used for the pages changes.
+func pagesFingerprint(list []textPage) string {
+	var b strings.Builder
+	for _, p := range list {
+		for _, l := range AvailableLanguages() {
+			path := localisedPath(p.File, l)
+			stat, err := os.Stat(path)
+			if err != nil {
+				fmt.Fprintf(&b, "%s:missing;", path)
+				continue
+			}
+			fmt.Fprintf(&b, "%s:%d:%d;", path, stat.ModTime().UnixNano(), stat.Size())
+		}
+	}
+	return b.String()
+}
+
+// footerLinksOf returns the links to all pages of the list shown in the footer.
+func footerLinksOf(list []textPage, t Translation) []footerLink {
+	links := make([]footerLink, 0, len(list))
+	for _, p := range list {
+		if p.FooterLink {
+			links = append(links, footerLink{Path: strings.Join([]string{config.ServerPath, "/", p.Path}, ""), Title: p.title(t)})
+		}
+	}
+	return links
+}
+
+// footerLinks returns the links to all pages shown in the footer.
+func footerLinks(t Translation) []footerLink {
+	textPagesLock.RLock()
+	defer textPagesLock.RUnlock()
+	return footerLinksOf(textPageList, t)
+}
+
+// textPagePaths returns the paths of all loaded pages.
+func textPagePaths() []string {
+	textPagesLock.RLock()
+	defer textPagesLock.RUnlock()
+	paths := make([]string, 0, len(textPageList))
+	for _, p := range textPageList {
+		paths = append(paths, p.Path)
+	}
+	return paths
+}
+
+// textPageHandle returns a handler serving a text page in the language of the user.
+func textPageHandle(path string) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		setSecurityHeaders(rw, r, "")
+		language := requestLanguage(rw, r)
+		textPagesLock.RLock()
+		defer textPagesLock.RUnlock()
+		b, ok := textPages[path][language]
+		if !ok {
+			b = textPages[path][GetDefaultTranslation().Language]
+		}
+		rw.Write(b)
+	}
+}
+
+// textPagesReloadWorker renders the pages again whenever one of their files changes.
+func textPagesReloadWorker() {
+	if config.PagesReloadSeconds <= 0 {
+		return
+	}
+
+	t := time.NewTicker(time.Duration(config.PagesReloadSeconds) * time.Second)
+	defer t.Stop()
+	failed := "" // fingerprint of files which could not be rendered
+	for {
+		select {
+		case <-stopPagesReload:
+			return
+		case <-t.C:
+			textPagesLock.RLock()
+			list := textPageList
+			old := textPagesFingerprint
+			textPagesLock.RUnlock()
+			fingerprint := pagesFingerprint(list)
+			if fingerprint == old || fingerprint == failed {
+				continue
+			}
+
+			log.Println("pages: files changed, rendering pages again")
+			configLock.RLock()
+			pathDSGVO, pathImpressum := config.PathDSGVO, config.PathImpressum
+			configLock.RUnlock()
+			err := loadTextPages(pathDSGVO, pathImpressum, config.Pages)
+			if err != nil {
+				log.Println("pages: can not render pages, keeping current pages:", err)
+				failed = fingerprint
+			}
+		}
+	}
+}
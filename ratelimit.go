@@ -0,0 +1,167 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Top-Ranger/writergo/auth"
+)
+
+// rateLimiterCleanup is the interval in which clients which did not use the limiter for a while are forgotten.
+const rateLimiterCleanup = time.Minute
+
+// rateLimiter limits the number of events per client address.
+// Each address has a token bucket holding up to burst tokens, which is refilled with rate tokens per second.
+// A nil rateLimiter allows all events.
+type rateLimiter struct {
+	l        sync.Mutex
+	rate     float64
+	burst    float64
+	buckets  map[string]*tokenBucket
+	lastTidy time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a limiter allowing n events per period and address.
+// Up to n events may happen at once. If n is not positive, nil is returned.
+func newRateLimiter(n int, period time.Duration) *rateLimiter {
+	if n <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		rate:     float64(n) / period.Seconds(),
+		burst:    float64(n),
+		buckets:  make(map[string]*tokenBucket),
+		lastTidy: time.Now(),
+	}
+}
+
+// Allow reports whether the client may cause another event.
+// If not, it also returns the time until the next event is allowed.
+func (r *rateLimiter) Allow(addr string) (bool, time.Duration) {
+	if r == nil {
+		return true, 0
+	}
+
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	now := time.Now()
+	r.tidy(now)
+
+	b := r.buckets[addr]
+	if b == nil {
+		b = &tokenBucket{tokens: r.burst, last: now}
+		r.buckets[addr] = b
+	}
+	b.tokens = math.Min(r.burst, b.tokens+now.Sub(b.last).Seconds()*r.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / r.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// tidy removes all buckets which are full again, since they behave like new buckets.
+// Caller must hold r.l.
+func (r *rateLimiter) tidy(now time.Time) {
+	if now.Sub(r.lastTidy) < rateLimiterCleanup {
+		return
+	}
+	r.lastTidy = now
+	for addr, b := range r.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*r.rate >= r.burst {
+			delete(r.buckets, addr)
+		}
+	}
+}
+
+var (
+	documentLimiter   *rateLimiter
+	connectionLimiter *rateLimiter
+	messageLimiter    *rateLimiter
+
+	// trustedProxies may set X-Forwarded-For.
+	trustedProxies auth.Networks
+)
+
+// initialiseRateLimits creates the rate limiters and reads the trusted proxies from the config.
+func initialiseRateLimits() error {
+	documentLimiter = newRateLimiter(config.RateLimitDocumentsPerMinute, time.Minute)
+	connectionLimiter = newRateLimiter(config.RateLimitConnectionsPerMinute, time.Minute)
+	messageLimiter = newRateLimiter(config.RateLimitMessagesPerSecond, time.Second)
+
+	var err error
+	trustedProxies, err = auth.ParseNetworks(config.TrustedProxies)
+	return err
+}
+
+// clientAddr returns the IP address of a remote address in the form host:port.
+func clientAddr(remote string) string {
+	host, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		return remote
+	}
+	return host
+}
+
+// requestClient returns the IP address of the client sending the request.
+// For requests of TrustedProxies (including other instances forwarding requests in cluster mode), the address is taken from X-Forwarded-For.
+// Each proxy appends the address it got the request from, so the last address which is not a trusted proxy is the client.
+func requestClient(r *http.Request) string {
+	client := clientAddr(r.RemoteAddr)
+	if !trustedProxies.Contains(client) {
+		return client
+	}
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(forwarded[i])
+		if addr == "" {
+			continue
+		}
+		client = addr
+		if !trustedProxies.Contains(addr) {
+			break
+		}
+	}
+	return client
+}
+
+// limitRequest checks whether the client is within the limit.
+// If not, it answers the request with 429 Too Many Requests and returns false.
+func limitRequest(l *rateLimiter, rw http.ResponseWriter, client, what string) bool {
+	ok, wait := l.Allow(client)
+	if ok {
+		return true
+	}
+	log.Printf("server: rate limit for %s exceeded by %s", what, client)
+	rw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(rw, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+	return false
+}
@@ -0,0 +1,153 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Top-Ranger/writergo/auth"
+)
+
+func TestRequestClient(t *testing.T) {
+	var err error
+	trustedProxies, err = auth.ParseNetworks([]string{"10.0.0.1", "192.168.0.0/24"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { trustedProxies = nil }()
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded string
+		cluster   bool
+		want      string
+	}{
+		{"direct", "203.0.113.1:1234", "", false, "203.0.113.1"},
+		{"untrusted peer", "203.0.113.1:1234", "198.51.100.7", false, "203.0.113.1"},
+		{"untrusted peer claiming cluster", "203.0.113.1:1234", "198.51.100.7", true, "203.0.113.1"},
+		{"trusted proxy", "10.0.0.1:1234", "198.51.100.7", false, "198.51.100.7"},
+		{"spoofed entry before proxy", "10.0.0.1:1234", "198.51.100.9, 198.51.100.7", false, "198.51.100.7"},
+		{"chain of proxies", "10.0.0.1:1234", "198.51.100.7, 192.168.0.5", false, "198.51.100.7"},
+		{"forwarding instance", "192.168.0.5:1234", "198.51.100.7", true, "198.51.100.7"},
+		{"trusted proxy without header", "10.0.0.1:1234", "", false, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if tt.cluster {
+				r.Header.Set(clusterForwardedHeader, "http://10.0.0.2:8782")
+			}
+			if got := requestClient(r); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// allowN returns how many of n events the limiter allows for the address.
+func allowN(r *rateLimiter, addr string, n int) int {
+	allowed := 0
+	for i := 0; i < n; i++ {
+		if ok, _ := r.Allow(addr); ok {
+			allowed++
+		}
+	}
+	return allowed
+}
+
+// ageBucket moves the last use of the bucket of the address into the past.
+func ageBucket(r *rateLimiter, addr string, d time.Duration) {
+	r.l.Lock()
+	defer r.l.Unlock()
+	r.buckets[addr].last = r.buckets[addr].last.Add(-d)
+}
+
+func TestRateLimiter(t *testing.T) {
+	if newRateLimiter(0, time.Minute) != nil {
+		t.Error("limiter without events is not nil")
+	}
+	var disabled *rateLimiter
+	if got := allowN(disabled, "a", 100); got != 100 {
+		t.Errorf("nil limiter allowed %d of 100 events", got)
+	}
+
+	r := newRateLimiter(3, time.Minute)
+	if got := allowN(r, "a", 5); got != 3 {
+		t.Errorf("allowed %d events at once, want 3", got)
+	}
+	ok, wait := r.Allow("a")
+	if ok || wait <= 19*time.Second || wait > 20*time.Second {
+		t.Errorf("got %t and wait %s, want to wait about 20s", ok, wait)
+	}
+	if got := allowN(r, "b", 3); got != 3 {
+		t.Errorf("other address allowed %d events, want 3", got)
+	}
+
+	// One token is refilled every 20s
+	ageBucket(r, "a", 20*time.Second)
+	if got := allowN(r, "a", 3); got != 1 {
+		t.Errorf("allowed %d events after 20s, want 1", got)
+	}
+	ageBucket(r, "a", 50*time.Second)
+	if got := allowN(r, "a", 3); got != 2 {
+		t.Errorf("allowed %d events after 50s, want 2", got)
+	}
+
+	// The bucket never holds more than the burst
+	ageBucket(r, "a", time.Hour)
+	if got := allowN(r, "a", 5); got != 3 {
+		t.Errorf("allowed %d events after an hour, want 3", got)
+	}
+}
+
+func TestRateLimiterTidy(t *testing.T) {
+	r := newRateLimiter(3, time.Minute)
+	allowN(r, "full", 1)
+	allowN(r, "empty", 3)
+	ageBucket(r, "full", time.Minute)
+	ageBucket(r, "empty", 30*time.Second)
+
+	// Buckets are only removed once per rateLimiterCleanup
+	allowN(r, "other", 1)
+	r.l.Lock()
+	n := len(r.buckets)
+	r.lastTidy = r.lastTidy.Add(-rateLimiterCleanup)
+	r.l.Unlock()
+	if n != 3 {
+		t.Fatalf("got %d buckets before cleanup, want 3", n)
+	}
+
+	allowN(r, "other", 1)
+	r.l.Lock()
+	_, full := r.buckets["full"]
+	_, empty := r.buckets["empty"]
+	n = len(r.buckets)
+	r.l.Unlock()
+	if full || !empty || n != 2 {
+		t.Errorf("full bucket kept %t, empty bucket kept %t, %d buckets", full, empty, n)
+	}
+	// The remaining bucket still limits
+	if got := allowN(r, "empty", 3); got != 1 {
+		t.Errorf("allowed %d events after tidy, want 1", got)
+	}
+}
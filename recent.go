@@ -0,0 +1,332 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Top-Ranger/writergo/registry"
+)
+
+// recentCookie stores the recently opened documents of anonymous users.
+const recentCookie = "writergo_recent"
+
+// recentCookieAge is the time the recently opened documents of anonymous users are remembered.
+const recentCookieAge = 365 * 24 * time.Hour
+
+// maxRecentCookieBytes limits the size of recentCookie, browsers reject cookies larger than 4096 bytes.
+const maxRecentCookieBytes = 3500
+
+// recentKeyPrefix is the prefix of the keys the recently opened documents of users are stored under in the DataSafe.
+const recentKeyPrefix = "~recent/"
+
+// maxRecentDocuments is the maximum number of remembered documents per user, including pinned documents.
+const maxRecentDocuments = 20
+
+// nameParameter is the query parameter to create a document with a chosen name.
+const nameParameter = "name"
+
+// maxDocumentNameLength is the maximum length of chosen names of documents in bytes.
+const maxDocumentNameLength = 200
+
+// recentDocument represents a document the user opened.
+type recentDocument struct {
+	Key    string
+	Time   int64 // unix time of the last visit
+	Pinned bool  `json:",omitempty"`
+}
+
+// recentOption represents an entry of the list of recently opened documents.
+type recentOption struct {
+	Key    string
+	Path   string
+	Time   string
+	Pinned bool
+}
+
+var (
+	recentLock sync.Mutex
+	// memoryRecent keeps the recently opened documents of users if the DataSafe does not store data permanently.
+	memoryRecent = make(map[string][]recentDocument)
+
+	cookieKey []byte
+)
+
+// initialiseCookieKey sets the key recentCookie is signed with.
+// Without a secret, a random key is used and the cookies are invalid after a restart.
+func initialiseCookieKey(secret string) error {
+	if secret != "" {
+		cookieKey = []byte(secret)
+		return nil
+	}
+	log.Println("recent: CookieSecret not set, recently opened documents of anonymous users are forgotten on restart")
+	cookieKey = make([]byte, 32)
+	_, err := rand.Read(cookieKey)
+	return err
+}
+
+// signCookie returns the value together with its signature.
+func signCookie(value []byte) string {
+	mac := hmac.New(sha256.New, cookieKey)
+	mac.Write(value)
+	return strings.Join([]string{base64.RawURLEncoding.EncodeToString(value), base64.RawURLEncoding.EncodeToString(mac.Sum(nil))}, ".")
+}
+
+// verifyCookie returns the value of a cookie created by signCookie.
+// The bool indicates whether the signature is valid.
+func verifyCookie(cookie string) ([]byte, bool) {
+	v, s, ok := strings.Cut(cookie, ".")
+	if !ok {
+		return nil, false
+	}
+	value, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return nil, false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, false
+	}
+	mac := hmac.New(sha256.New, cookieKey)
+	mac.Write(value)
+	return value, hmac.Equal(signature, mac.Sum(nil))
+}
+
+// loadRecent returns the recently opened documents of the user.
+// Caller must hold recentLock.
+func loadRecent(r *http.Request, id registry.Identity) ([]recentDocument, error) {
+	var data []byte
+	switch {
+	case id.Anonymous():
+		c, err := r.Cookie(recentCookie)
+		if err != nil {
+			return nil, nil
+		}
+		value, ok := verifyCookie(c.Value)
+		if !ok {
+			// Cookies of a previous key or modified by the user are ignored
+			return nil, nil
+		}
+		data = value
+	case !ds.IsPermanent():
+		return append([]recentDocument(nil), memoryRecent[id.User]...), nil
+	default:
+		s, err := ds.LoadWriter(strings.Join([]string{recentKeyPrefix, id.User}, ""))
+		if err != nil {
+			return nil, fmt.Errorf("can not load recent documents: %w", err)
+		}
+		if s == "" {
+			return nil, nil
+		}
+		data = []byte(s)
+	}
+
+	var documents []recentDocument
+	err := json.Unmarshal(data, &documents)
+	if err != nil {
+		return nil, fmt.Errorf("can not parse recent documents: %w", err)
+	}
+	return documents, nil
+}
+
+// saveRecent stores the recently opened documents of the user.
+// For anonymous users, the oldest documents are dropped if the cookie gets too large.
+// Caller must hold recentLock.
+func saveRecent(rw http.ResponseWriter, r *http.Request, id registry.Identity, documents []recentDocument) error {
+	if !id.Anonymous() && !ds.IsPermanent() {
+		memoryRecent[id.User] = documents
+		return nil
+	}
+
+	for {
+		b, err := json.Marshal(documents)
+		if err != nil {
+			return fmt.Errorf("can not encode recent documents: %w", err)
+		}
+		if !id.Anonymous() {
+			return ds.SaveWriter(strings.Join([]string{recentKeyPrefix, id.User}, ""), string(b))
+		}
+		value := signCookie(b)
+		if len(value) > maxRecentCookieBytes && len(documents) > 0 {
+			documents = documents[:len(documents)-1]
+			continue
+		}
+		http.SetCookie(rw, &http.Cookie{
+			Name:     recentCookie,
+			Value:    value,
+			Path:     rootPath,
+			MaxAge:   int(recentCookieAge.Seconds()),
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+		return nil
+	}
+}
+
+// sortRecent sorts the documents with pinned documents first, then by the time of the last visit.
+func sortRecent(documents []recentDocument) {
+	sort.SliceStable(documents, func(i, j int) bool {
+		if documents[i].Pinned != documents[j].Pinned {
+			return documents[i].Pinned
+		}
+		return documents[i].Time > documents[j].Time
+	})
+}
+
+// updateRecent applies f to the recently opened documents of the user and stores the result.
+func updateRecent(rw http.ResponseWriter, r *http.Request, id registry.Identity, f func([]recentDocument) []recentDocument) error {
+	recentLock.Lock()
+	defer recentLock.Unlock()
+	documents, err := loadRecent(r, id)
+	if err != nil {
+		return err
+	}
+	documents = f(documents)
+	sortRecent(documents)
+	return saveRecent(rw, r, id, documents)
+}
+
+// recordRecent remembers that the user opened the document.
+// If too many documents are remembered, the oldest document which is not pinned is forgotten.
+func recordRecent(rw http.ResponseWriter, r *http.Request, id registry.Identity, key string) {
+	err := updateRecent(rw, r, id, func(documents []recentDocument) []recentDocument {
+		// The document is moved to the front, so it stays first among documents visited in the same second
+		d := recentDocument{Key: key, Time: time.Now().Unix()}
+		for i := range documents {
+			if documents[i].Key == key {
+				d.Pinned = documents[i].Pinned
+				documents = append(documents[:i], documents[i+1:]...)
+				return append([]recentDocument{d}, documents...)
+			}
+		}
+		if len(documents) >= maxRecentDocuments {
+			// The documents are sorted, so the last document which is not pinned is the oldest
+			oldest := -1
+			for i := len(documents) - 1; i >= 0; i-- {
+				if !documents[i].Pinned {
+					oldest = i
+					break
+				}
+			}
+			if oldest == -1 {
+				// Only pinned documents
+				return documents
+			}
+			documents = append(documents[:oldest], documents[oldest+1:]...)
+		}
+		return append([]recentDocument{d}, documents...)
+	})
+	if err != nil {
+		log.Println(key, "can not record recent document:", err)
+	}
+}
+
+// recentOptions returns the recently opened documents of the user for the landing page.
+func recentOptions(r *http.Request, id registry.Identity) []recentOption {
+	recentLock.Lock()
+	documents, err := loadRecent(r, id)
+	recentLock.Unlock()
+	if err != nil {
+		log.Println("recent:", err)
+		return nil
+	}
+	sortRecent(documents)
+
+	options := make([]recentOption, 0, len(documents))
+	for _, d := range documents {
+		options = append(options, recentOption{
+			Key:    d.Key,
+			Path:   strings.Join([]string{config.ServerPath, "/", url.PathEscape(d.Key)}, ""),
+			Time:   time.Unix(d.Time, 0).Format("2006-01-02 15:04"),
+			Pinned: d.Pinned,
+		})
+	}
+	return options
+}
+
+// recentHandle pins, unpins or forgets a recently opened document of the user.
+func recentHandle(rw http.ResponseWriter, r *http.Request, id registry.Identity) {
+	if !checkOrigin(r) {
+		http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(rw, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	key := r.PostForm.Get("key")
+	action := r.PostForm.Get("action")
+
+	err = updateRecent(rw, r, id, func(documents []recentDocument) []recentDocument {
+		for i := range documents {
+			if documents[i].Key != key {
+				continue
+			}
+			switch action {
+			case "pin":
+				documents[i].Pinned = true
+			case "unpin":
+				documents[i].Pinned = false
+			case "remove":
+				return append(documents[:i], documents[i+1:]...)
+			}
+			break
+		}
+		return documents
+	})
+	if err != nil {
+		log.Println("recent:", err)
+		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(rw, r, rootPath, http.StatusSeeOther)
+}
+
+// validDocumentName reports whether a name chosen by the user can be used as the key of a document.
+// Names must not collide with other paths of the server.
+func validDocumentName(name string) bool {
+	if name == "" || len(name) > maxDocumentNameLength || !utf8.ValidString(name) {
+		return false
+	}
+	if strings.HasPrefix(name, reservedKeyPrefix) || strings.Contains(name, "/") || name == "." || name == ".." {
+		return false
+	}
+	if reservedNames[name] {
+		return false
+	}
+	for _, c := range name {
+		if unicode.IsControl(c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestValidDocumentName(t *testing.T) {
+	handle("reserved-prefix/", func(rw http.ResponseWriter, r *http.Request) {})
+	handle("reserved-page.html", func(rw http.ResponseWriter, r *http.Request) {})
+
+	for name, want := range map[string]bool{
+		"notes":              true,
+		"Meeting 2026-10-19": true,
+		"reserved-prefix":    false,
+		"reserved-page.html": false,
+		"":                   false,
+		"a/b":                false,
+		"..":                 false,
+		"~recent/alice":      false,
+		"line\nbreak":        false,
+	} {
+		if got := validDocumentName(name); got != want {
+			t.Errorf("validDocumentName(%q) = %t, want %t", name, got, want)
+		}
+	}
+}
+
+func TestVerifyCookie(t *testing.T) {
+	old := cookieKey
+	t.Cleanup(func() { cookieKey = old })
+	err := initialiseCookieKey("other secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey := signCookie([]byte(`["notes"]`))
+	err = initialiseCookieKey("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := signCookie([]byte(`["notes"]`))
+	value, signature, _ := strings.Cut(valid, ".")
+	tampered := base64.RawURLEncoding.EncodeToString([]byte(`["secret"]`))
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig[0] ^= 1
+
+	tests := []struct {
+		name   string
+		cookie string
+		want   bool
+	}{
+		{"valid", valid, true},
+		{"tampered value", strings.Join([]string{tampered, signature}, "."), false},
+		{"tampered signature", strings.Join([]string{value, base64.RawURLEncoding.EncodeToString(sig)}, "."), false},
+		{"swapped parts", strings.Join([]string{signature, value}, "."), false},
+		{"missing signature", value, false},
+		{"empty signature", strings.Join([]string{value, ""}, "."), false},
+		{"additional part", strings.Join([]string{valid, signature}, "."), false},
+		{"invalid encoding", strings.Join([]string{"!", signature}, "."), false},
+		{"other key", otherKey, false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := verifyCookie(tt.cookie)
+			if ok != tt.want {
+				t.Fatalf("got %t, want %t", ok, tt.want)
+			}
+			if ok && string(got) != `["notes"]` {
+				t.Errorf("got value %s", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// DecodeConfig decodes a plug-in configuration given as a JSON object into v.
+// Any other configuration is passed to plain for backwards compatibility.
+// Unknown options are rejected to catch typos.
+func DecodeConfig(data []byte, v interface{}, plain func(string)) error {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		plain(string(data))
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if err != nil {
+		return fmt.Errorf("can not parse config: %w", err)
+	}
+	if dec.More() {
+		return errors.New("can not parse config: trailing data")
+	}
+	return nil
+}
@@ -13,12 +13,15 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// Package registry provides a central way to register and use all available saving backends.
+// Package registry provides a central way to register and use all available saving backends, message busses, authenticators and audit sinks.
 // All options should be registered prior to the program starting, normally through init().
 package registry
 
 import (
+	"errors"
+	"net/http"
 	"sync"
+	"time"
 )
 
 // AlreadyRegisteredError represents an error where an option is already registeres
@@ -30,6 +33,7 @@ func (a AlreadyRegisteredError) Error() string {
 }
 
 // DataSafe represents a backend for save storage of writer status.
+// LoadConfig receives either the content of a configured string or a JSON object.
 // All methods must be save for parallel usage.
 type DataSafe interface {
 	SaveWriter(key, data string) error
@@ -39,9 +43,153 @@ type DataSafe interface {
 	FlushAndClose()
 }
 
+// ErrVersionConflict is returned by VersionedDataSafe if the stored version does not match the expected one.
+var ErrVersionConflict = errors.New("version conflict")
+
+// VersionedDataSafe is implemented by data safes which support optimistic concurrency.
+// Each saved state has a version, which changes whenever the state changes.
+// The empty version represents a writer without saved state.
+// All methods must be save for parallel usage.
+type VersionedDataSafe interface {
+	// LoadWriterVersion returns the saved state and its version.
+	LoadWriterVersion(key string) (data, version string, err error)
+	// SaveWriterVersion saves the state only if the saved version still equals version.
+	// It returns the new version or ErrVersionConflict if the versions do not match.
+	SaveWriterVersion(key, data, version string) (string, error)
+}
+
+// KeyLimiter is implemented by data safes which only support keys up to a maximum length.
+// MaxKeyLength returns the maximum length of a key in bytes.
+type KeyLimiter interface {
+	MaxKeyLength() int
+}
+
+// Leaser is implemented by data safes which can coordinate multiple instances of WriterGo!.
+// A lease grants a single instance the ownership of a writer for a limited time.
+// All methods must be save for parallel usage.
+type Leaser interface {
+	// AcquireLease acquires or renews the lease of key for instance if it is free, expired or already held by instance.
+	// It returns the owner of the lease after the operation.
+	AcquireLease(key, instance string, d time.Duration) (string, error)
+	// ReleaseLease releases the lease of key if it is held by instance.
+	ReleaseLease(key, instance string) error
+}
+
+// ErrUnknownToken is returned by TokenStore if the requested token does not exist.
+var ErrUnknownToken = errors.New("unknown token")
+
+// APIToken represents a long-lived token used by automated clients.
+// Only the hash of the token is stored, the token itself is only known to the client.
+type APIToken struct {
+	ID      string    // public identifier used to list and revoke the token
+	Hash    string    // hex encoded SHA-256 hash of the token
+	User    string    // user the token acts as
+	Scopes  []string  // scopes granted to the token
+	Created time.Time // time of creation
+}
+
+// TokenStore is implemented by data safes which can store API tokens.
+// All methods must be save for parallel usage.
+type TokenStore interface {
+	// SaveToken stores a new token.
+	SaveToken(t APIToken) error
+	// LoadToken returns the token with the given hash.
+	// The bool indicates whether the token exists.
+	LoadToken(hash string) (APIToken, bool, error)
+	// ListTokens returns all stored tokens.
+	ListTokens() ([]APIToken, error)
+	// DeleteToken revokes the token with the given ID.
+	// It returns ErrUnknownToken if no such token exists.
+	DeleteToken(id string) error
+}
+
+// Bus represents a message bus connecting multiple instances of WriterGo!.
+// Messages published to a topic are delivered to all subscribers of the topic, including subscribers of the publishing instance.
+// Messages of a single publisher must be delivered in order.
+// Topics only consist of letters, digits and dots.
+// All methods must be save for parallel usage.
+type Bus interface {
+	Publish(topic string, data []byte) error
+	Subscribe(topic string, handler func(data []byte)) (Subscription, error)
+	LoadConfig(data []byte) error
+	Close()
+}
+
+// LocalBus is implemented by buses which only deliver messages inside of the current process.
+// Subscribers returns the number of subscriptions of a topic, so publishing can be skipped if nobody else would receive the message.
+// All methods must be save for parallel usage.
+type LocalBus interface {
+	Subscribers(topic string) int
+}
+
+// Subscription represents a subscription to a topic of a Bus.
+type Subscription interface {
+	Unsubscribe() error
+}
+
+// Identity represents an authenticated user.
+type Identity struct {
+	User   string   // unique name of the user, empty for anonymous users
+	Name   string   // display name, might be empty
+	Groups []string // groups of the user, might be empty
+	Scopes []string // scopes of the API token used, empty if the user is not restricted by scopes
+	Token  string   // hash of the API token used, empty if the user did not authenticate with an API token
+}
+
+// Anonymous returns whether the identity belongs to a user who is not authenticated.
+func (i Identity) Anonymous() bool {
+	return i.User == ""
+}
+
+// Authenticator authenticates the users of WriterGo!.
+// Authenticate returns the identity of the user sending the request.
+// If the user can not be authenticated, Authenticate must write a response (e.g. asking for credentials or redirecting to a login page) and return false.
+// LoadConfig receives either the content of a configured string or a JSON object.
+// All methods must be save for parallel usage.
+type Authenticator interface {
+	Authenticate(rw http.ResponseWriter, r *http.Request) (Identity, bool)
+	LoadConfig(data []byte) error
+}
+
+// ServerPathReceiver is implemented by authenticators which need to know the path WriterGo! is served under, e.g. to scope cookies.
+// SetServerPath is called with the configured ServerPath before LoadConfig. The path is empty if WriterGo! is served under the root.
+type ServerPathReceiver interface {
+	SetServerPath(path string)
+}
+
+// AuditEvent represents an action on a document recorded in the audit log.
+type AuditEvent struct {
+	Time       time.Time
+	Action     string // e.g. "open", "save"
+	Document   string // key of the document
+	Connection string `json:",omitempty"` // key of the websocket connection, if any
+	RemoteAddr string `json:",omitempty"` // address of the client, if known
+	User       string `json:",omitempty"` // authenticated user, empty for anonymous users
+	Detail     string `json:",omitempty"` // additional information depending on the action
+}
+
+// AuditSink stores the events of the audit log.
+// Record is called for events in the order they occurred.
+// LoadConfig receives either the content of a configured string or a JSON object.
+// All methods must be save for parallel usage.
+type AuditSink interface {
+	Record(e AuditEvent) error
+	LoadConfig(data []byte) error
+	Close()
+}
+
 var (
 	knownDataSafes      = make(map[string]DataSafe)
 	knownDataSafesMutex = sync.RWMutex{}
+
+	knownBusses      = make(map[string]Bus)
+	knownBussesMutex = sync.RWMutex{}
+
+	knownAuthenticators      = make(map[string]Authenticator)
+	knownAuthenticatorsMutex = sync.RWMutex{}
+
+	knownAuditSinks      = make(map[string]AuditSink)
+	knownAuditSinksMutex = sync.RWMutex{}
 )
 
 // RegisterDataSafe registeres a data safe.
@@ -67,3 +215,75 @@ func GetDataSafe(name string) (DataSafe, bool) {
 	f, ok := knownDataSafes[name]
 	return f, ok
 }
+
+// RegisterBus registeres a message bus.
+// The name of the bus is used as an identifier and must be unique.
+// You can savely use it in parallel.
+func RegisterBus(b Bus, name string) error {
+	knownBussesMutex.Lock()
+	defer knownBussesMutex.Unlock()
+
+	_, ok := knownBusses[name]
+	if ok {
+		return AlreadyRegisteredError("Bus already registered")
+	}
+	knownBusses[name] = b
+	return nil
+}
+
+// GetBus returns a message bus.
+// The bool indicates whether it existed. You can only use it if the bool is true.
+func GetBus(name string) (Bus, bool) {
+	knownBussesMutex.RLock()
+	defer knownBussesMutex.RUnlock()
+	b, ok := knownBusses[name]
+	return b, ok
+}
+
+// RegisterAuthenticator registeres an authenticator.
+// The name of the authenticator is used as an identifier and must be unique.
+// You can savely use it in parallel.
+func RegisterAuthenticator(a Authenticator, name string) error {
+	knownAuthenticatorsMutex.Lock()
+	defer knownAuthenticatorsMutex.Unlock()
+
+	_, ok := knownAuthenticators[name]
+	if ok {
+		return AlreadyRegisteredError("Authenticator already registered")
+	}
+	knownAuthenticators[name] = a
+	return nil
+}
+
+// GetAuthenticator returns an authenticator.
+// The bool indicates whether it existed. You can only use it if the bool is true.
+func GetAuthenticator(name string) (Authenticator, bool) {
+	knownAuthenticatorsMutex.RLock()
+	defer knownAuthenticatorsMutex.RUnlock()
+	a, ok := knownAuthenticators[name]
+	return a, ok
+}
+
+// RegisterAuditSink registeres an audit sink.
+// The name of the audit sink is used as an identifier and must be unique.
+// You can savely use it in parallel.
+func RegisterAuditSink(a AuditSink, name string) error {
+	knownAuditSinksMutex.Lock()
+	defer knownAuditSinksMutex.Unlock()
+
+	_, ok := knownAuditSinks[name]
+	if ok {
+		return AlreadyRegisteredError("AuditSink already registered")
+	}
+	knownAuditSinks[name] = a
+	return nil
+}
+
+// GetAuditSink returns an audit sink.
+// The bool indicates whether it existed. You can only use it if the bool is true.
+func GetAuditSink(name string) (AuditSink, bool) {
+	knownAuditSinksMutex.RLock()
+	defer knownAuditSinksMutex.RUnlock()
+	a, ok := knownAuditSinks[name]
+	return a, ok
+}
@@ -0,0 +1,133 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// configLock protects all config values which can be changed while running.
+var configLock sync.RWMutex
+
+// liveConfig contains all config values which are applied by reloadConfig.
+var liveConfig = map[string]bool{
+	"Language":             true,
+	"TranslationDirectory": true,
+	"SyncSeconds":          true,
+	"GCMinutes":            true,
+	"PathImpressum":        true,
+	"PathDSGVO":            true,
+	"Templates":            true,
+}
+
+// syncInterval returns the interval between syncs of the clients.
+func syncInterval() time.Duration {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return time.Duration(config.SyncSeconds) * time.Second
+}
+
+// gcInterval returns the interval of the garbage collection and of backups.
+func gcInterval() time.Duration {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return time.Duration(config.GCMinutes) * time.Minute
+}
+
+// reloadConfig loads the config again and applies all values which can be changed while running.
+// Changes to all other values are logged, since they require a restart.
+func reloadConfig(path string, flags map[string]string) {
+	log.Println("reload: reloading config")
+	c, err := loadConfig(path, flags)
+	if err != nil {
+		log.Println("reload: can not load config, keeping current config:", err)
+		return
+	}
+
+	configLock.RLock()
+	old := config
+	configLock.RUnlock()
+
+	if (c.GCMinutes <= 0) != (old.GCMinutes <= 0) {
+		log.Println("reload: enabling or disabling GCMinutes requires a restart")
+		c.GCMinutes = old.GCMinutes
+	}
+	if c.SyncSeconds < 0 {
+		log.Println("reload: SyncSeconds must not be negative")
+		c.SyncSeconds = old.SyncSeconds
+	}
+
+	// Always load the translations again, since the files in TranslationDirectory might have changed
+	reloaded := true
+	err = LoadTranslations(c.TranslationDirectory)
+	if err != nil {
+		log.Println("reload: can not load translations, keeping current translations:", err)
+		c.TranslationDirectory = old.TranslationDirectory
+		reloaded = false
+	}
+
+	if reloaded || c.Language != old.Language {
+		err = SetDefaultTranslation(c.Language)
+		if err != nil {
+			log.Printf("reload: can not set language '%s': %s", c.Language, err.Error())
+			c.Language = old.Language
+		} else if c.Language != old.Language {
+			log.Printf("reload: setting language to '%s'", c.Language)
+		}
+	}
+
+	// Always render the pages again, since the files or the language might have changed
+	// Changes to Pages require a restart, since the handlers of the pages are registered on start
+	err = loadTextPages(c.PathDSGVO, c.PathImpressum, old.Pages)
+	if err != nil {
+		log.Println("reload: can not load pages, keeping current pages:", err)
+		c.PathDSGVO = old.PathDSGVO
+		c.PathImpressum = old.PathImpressum
+	}
+
+	// Always read the templates again, since the files might have changed
+	err = loadDocumentTemplates(c.Templates)
+	if err != nil {
+		log.Println("reload: can not load templates, keeping current templates:", err)
+		c.Templates = old.Templates
+	}
+
+	configLock.Lock()
+	config.Language = c.Language
+	config.TranslationDirectory = c.TranslationDirectory
+	config.SyncSeconds = c.SyncSeconds
+	config.GCMinutes = c.GCMinutes
+	config.PathImpressum = c.PathImpressum
+	config.PathDSGVO = c.PathDSGVO
+	config.Templates = c.Templates
+	configLock.Unlock()
+
+	vOld := reflect.ValueOf(old)
+	vNew := reflect.ValueOf(c)
+	for i := 0; i < vOld.NumField(); i++ {
+		name := vOld.Type().Field(i).Name
+		if liveConfig[name] {
+			continue
+		}
+		if !reflect.DeepEqual(vOld.Field(i).Interface(), vNew.Field(i).Interface()) {
+			log.Printf("reload: %s changed, restart required to apply it", name)
+		}
+	}
+	log.Println("reload: finished")
+}
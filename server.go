@@ -16,19 +16,19 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"embed"
 	"fmt"
 	"html/template"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
-	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -39,19 +39,22 @@ var serverStarted bool
 var server http.Server
 var rootPath string
 
+// reservedNames contains the first path segment of all handlers registered below ServerPath.
+// It is only written while initialising the server.
+var reservedNames = make(map[string]bool)
+
 var writerMap = make(map[string]*writer)
 var writerMapLock = new(sync.Mutex)
+var writerDeleting = make(map[string]chan struct{}) // key -> closed once the removed writer is saved, guarded by writerMapLock
 var upgrader = websocket.Upgrader{}
-var stopGC = make(chan bool)
+var stopGC = make(chan struct{})
 
 //go:embed template
 var templateFiles embed.FS
 
 var textTemplate *template.Template
 var mainTemplate *template.Template
-
-var dsgvo []byte
-var impressum []byte
+var landingTemplate *template.Template
 
 //go:embed static font js css
 var cachedFiles embed.FS
@@ -63,6 +66,7 @@ Disallow: /`)
 
 func init() {
 	upgrader.HandshakeTimeout = 30 * time.Second
+	upgrader.CheckOrigin = checkOrigin
 
 	var err error
 
@@ -76,6 +80,11 @@ func init() {
 		panic(err)
 	}
 
+	landingTemplate, err = template.ParseFS(templateFiles, "template/landing.html")
+	if err != nil {
+		panic(err)
+	}
+
 	cssTemplates, err = template.ParseFS(cachedFiles, "css/*")
 	if err != nil {
 		panic(err)
@@ -84,15 +93,34 @@ func init() {
 
 type textTemplateStruct struct {
 	Text        template.HTML
+	Title       string
 	Translation Translation
+	Languages   []languageOption
+	FooterLinks []footerLink
 	ServerPath  string
 }
 
 type mainTemplateStruct struct {
-	SyncTime      int
-	Translation   Translation
-	ServerPath    string
-	PermanentSave bool
+	Nonce            string
+	SyncTime         int
+	Translation      Translation
+	ServerPath       string
+	PermanentSave    bool
+	MaxDocumentBytes int
+	Role             string
+	Languages        []languageOption
+	FooterLinks      []footerLink
+}
+
+type landingTemplateStruct struct {
+	Translation Translation
+	Templates   []templateOption
+	ShowRecent  bool
+	Recent      []recentOption
+	InvalidName bool
+	Languages   []languageOption
+	FooterLinks []footerLink
+	ServerPath  string
 }
 
 func initialiseServer() error {
@@ -104,32 +132,23 @@ func initialiseServer() error {
 	// Do setup
 	rootPath = strings.Join([]string{config.ServerPath, "/"}, "")
 
-	// DSGVO
-	b, err := os.ReadFile(config.PathDSGVO)
+	err := loadTextPages(config.PathDSGVO, config.PathImpressum, config.Pages)
 	if err != nil {
 		return err
 	}
-	text := textTemplateStruct{Format(b), GetDefaultTranslation(), config.ServerPath}
-	output := bytes.NewBuffer(make([]byte, 0, len(text.Text)*2))
-	textTemplate.Execute(output, text)
-	dsgvo = output.Bytes()
-
-	http.HandleFunc(strings.Join([]string{config.ServerPath, "/dsgvo.html"}, ""), func(rw http.ResponseWriter, r *http.Request) {
-		rw.Write(dsgvo)
-	})
-
-	// Impressum
-	b, err = os.ReadFile(config.PathImpressum)
+	for _, p := range textPagePaths() {
+		handle(p, textPageHandle(p))
+	}
+	err = loadDocumentTemplates(config.Templates)
 	if err != nil {
 		return err
 	}
-	text = textTemplateStruct{Format(b), GetDefaultTranslation(), config.ServerPath}
-	output = bytes.NewBuffer(make([]byte, 0, len(text.Text)*2))
-	textTemplate.Execute(output, text)
-	impressum = output.Bytes()
-	http.HandleFunc(strings.Join([]string{config.ServerPath, "/impressum.html"}, ""), func(rw http.ResponseWriter, r *http.Request) {
-		rw.Write(impressum)
-	})
+	if config.LandingPage {
+		err = initialiseCookieKey(config.CookieSecret)
+		if err != nil {
+			return err
+		}
+	}
 
 	etag := fmt.Sprint("\"", strconv.FormatInt(time.Now().Unix(), 10), "\"")
 	etagCompare := strings.TrimSuffix(etag, "\"")
@@ -137,6 +156,8 @@ func initialiseServer() error {
 	etagCompareCaddy := strings.Join([]string{"W/", etagCompare, "\""}, "") // Dirty hack for caddy, who appends W/ before the quotes if the file is compressed, thus preventing If-None-Match matching the ETag
 
 	staticHandle := func(rw http.ResponseWriter, r *http.Request) {
+		setSecurityHeaders(rw, r, "")
+
 		// Check for ETag
 		v, ok := r.Header["If-None-Match"]
 		if ok {
@@ -186,12 +207,14 @@ func initialiseServer() error {
 		}
 	}
 
-	http.HandleFunc(strings.Join([]string{config.ServerPath, "/css/"}, ""), staticHandle)
-	http.HandleFunc(strings.Join([]string{config.ServerPath, "/static/"}, ""), staticHandle)
-	http.HandleFunc(strings.Join([]string{config.ServerPath, "/font/"}, ""), staticHandle)
-	http.HandleFunc(strings.Join([]string{config.ServerPath, "/js/"}, ""), staticHandle)
+	handle("css/", staticHandle)
+	handle("static/", staticHandle)
+	handle("font/", staticHandle)
+	handle("js/", staticHandle)
+
+	handle("favicon.ico", func(rw http.ResponseWriter, r *http.Request) {
+		setSecurityHeaders(rw, r, "")
 
-	http.HandleFunc(strings.Join([]string{config.ServerPath, "/favicon.ico"}, ""), func(rw http.ResponseWriter, r *http.Request) {
 		// Check for ETag
 		v, ok := r.Header["If-None-Match"]
 		if ok {
@@ -214,18 +237,61 @@ func initialiseServer() error {
 	})
 
 	// robots.txt
-	http.HandleFunc(strings.Join([]string{config.ServerPath, "/robots.txt"}, ""), func(rw http.ResponseWriter, r *http.Request) {
+	handle("robots.txt", func(rw http.ResponseWriter, r *http.Request) {
 		rw.Write(robottxt)
 	})
 
-	http.HandleFunc("/", rootHandle)
+	http.HandleFunc("/", authenticate(rootHandle))
 	return nil
 }
 
+// handle registers a handler below ServerPath.
+// The first segment of pattern is reserved, so no document can be named like it.
+func handle(pattern string, h http.HandlerFunc) {
+	http.HandleFunc(strings.Join([]string{config.ServerPath, "/", pattern}, ""), h)
+	name, _, _ := strings.Cut(pattern, "/")
+	reservedNames[name] = true
+}
+
+// openDocumentsRetrySeconds is the time clients are asked to wait if too many documents are open.
+const openDocumentsRetrySeconds = 60
+
+// tooManyDocuments reports whether no further document can be opened because of MaxOpenDocuments.
+// Caller must hold writerMapLock.
+func tooManyDocuments() bool {
+	return config.MaxOpenDocuments > 0 && len(writerMap) >= config.MaxOpenDocuments
+}
+
 func rootHandle(rw http.ResponseWriter, r *http.Request) {
 	if r.URL.Path == rootPath || r.URL.Path == config.ServerPath || r.URL.Path == "/" {
-		// redirect too random ressource
-		target := strings.Join([]string{config.ServerPath, "/", url.PathEscape(RandomString())}, "")
+		if r.Method == http.MethodPost && config.LandingPage {
+			recentHandle(rw, r, requestIdentity(r))
+			return
+		}
+		q := r.URL.Query()
+		if !q.Has(templateParameter) && !q.Has(nameParameter) && (config.LandingPage || hasDocumentTemplates()) {
+			landingHandle(rw, r, false)
+			return
+		}
+		fromTemplate := q.Get(templateParameter)
+		if _, ok := documentTemplate(fromTemplate, ""); fromTemplate != "" && !ok {
+			http.NotFound(rw, r)
+			return
+		}
+		name := strings.TrimSpace(q.Get(nameParameter))
+		if name != "" && !validDocumentName(name) {
+			landingHandle(rw, r, true)
+			return
+		}
+		// The document is created and charged against documentLimiter when its websocket is opened
+		if name == "" {
+			// redirect too random ressource
+			name = RandomString()
+		}
+		target := strings.Join([]string{config.ServerPath, "/", url.PathEscape(name)}, "")
+		if fromTemplate != "" {
+			target = strings.Join([]string{target, "?", templateParameter, "=", url.QueryEscape(fromTemplate)}, "")
+		}
 		http.Redirect(rw, r, target, http.StatusSeeOther)
 		return
 	}
@@ -233,9 +299,73 @@ func rootHandle(rw http.ResponseWriter, r *http.Request) {
 	key := r.URL.Path
 	key = strings.TrimLeft(key, "/")
 
+	if strings.HasPrefix(key, reservedKeyPrefix) {
+		http.NotFound(rw, r)
+		return
+	}
+	if max := maxDocumentKeyLength(); max > 0 && len(key) > max {
+		http.Error(rw, fmt.Sprintf("Document name is too long (at most %d bytes)", max), http.StatusRequestURITooLong)
+		return
+	}
+
 	ws := r.URL.Query().Get("ws")
+	identity := requestIdentity(r)
+
+	if ws == "" {
+		err := claimDocument(key, identity)
+		if err != nil {
+			log.Println(key, "can not claim document:", err)
+		}
+	}
+	role, err := documentRole(key, identity)
+	if err != nil {
+		log.Println(key, "role:", err)
+		http.Error(rw, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	if !hasRole(role, roleViewer) {
+		auditRequest(r, auditDenied, key, "")
+		http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
 
 	if ws != "" {
+		owner, err := clusterOwner(key)
+		if err != nil {
+			log.Println(key, "cluster owner:", err)
+			http.Error(rw, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		if owner != config.ClusterInstance {
+			clusterForward(rw, r, key, owner)
+			return
+		}
+
+		client := requestClient(r)
+		if !limitRequest(connectionLimiter, rw, client, "connections") {
+			return
+		}
+		writerMapLock.Lock()
+		open := writerMap[key] != nil
+		full := !open && tooManyDocuments()
+		writerMapLock.Unlock()
+		if full {
+			log.Println(key, "not opened: too many open documents")
+			rw.Header().Set("Retry-After", strconv.Itoa(openDocumentsRetrySeconds))
+			http.Error(rw, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		if !open && !limitRequest(documentLimiter, rw, client, "new documents") {
+			return
+		}
+
+		// The language must be known before the connection is upgraded
+		fromTemplate := r.URL.Query().Get(templateParameter)
+		var language string
+		if fromTemplate != "" {
+			language = requestLanguage(rw, r)
+		}
+
 		// Upgrade connection and add to writer
 		conn, err := upgrader.Upgrade(rw, r, nil)
 		if err != nil {
@@ -244,35 +374,188 @@ func rootHandle(rw http.ResponseWriter, r *http.Request) {
 		}
 
 		writerMapLock.Lock()
+		for deleted := writerDeleting[key]; deleted != nil; deleted = writerDeleting[key] {
+			// The removed writer must be saved before its state is loaded again
+			writerMapLock.Unlock()
+			<-deleted
+			writerMapLock.Lock()
+		}
 		defer writerMapLock.Unlock()
 
 		w := writerMap[key]
 		if w == nil {
+			if tooManyDocuments() {
+				// Other documents were opened in the meantime
+				log.Println(key, "not opened: too many open documents")
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too many open documents"), time.Now().Add(writeTimeout))
+				conn.Close()
+				return
+			}
 			w = new(writer)
 			w.Key = key
 			w.Init()
 			writerMap[key] = w
+			if fromTemplate != "" && hasRole(role, roleEditor) {
+				w.applyTemplate(fromTemplate, language, identity.User)
+			}
 		}
 
-		err = w.AddNew(conn)
+		err = w.AddNew(conn, r.URL.Query().Get("session"), identity, role, client)
 		if err != nil {
 			log.Println(key, "add connection:", err)
 		}
 		return
 	}
 
+	auditRequest(r, auditView, key, role)
+	if config.LandingPage {
+		recordRecent(rw, r, identity, key)
+	}
+
+	nonce := RandomString()
+	setSecurityHeaders(rw, r, nonce)
+
 	td := mainTemplateStruct{
-		SyncTime:      config.SyncSeconds * 1000,
-		Translation:   GetDefaultTranslation(),
-		ServerPath:    config.ServerPath,
-		PermanentSave: ds.IsPermanent(),
+		Nonce:            nonce,
+		SyncTime:         int(syncInterval().Milliseconds()),
+		Translation:      requestTranslation(rw, r),
+		ServerPath:       config.ServerPath,
+		PermanentSave:    ds.IsPermanent(),
+		MaxDocumentBytes: config.MaxDocumentBytes,
+		Role:             role,
+		Languages:        languageOptions(),
 	}
-	err := mainTemplate.Execute(rw, td)
+	td.FooterLinks = footerLinks(td.Translation)
+	err = mainTemplate.Execute(rw, td)
 	if err != nil {
 		log.Println("main template:", err)
 	}
 }
 
+// landingHandle shows the page to create a new document and, if enabled, the recently opened documents.
+// invalidName reports that the chosen name of a new document can not be used.
+func landingHandle(rw http.ResponseWriter, r *http.Request, invalidName bool) {
+	setSecurityHeaders(rw, r, "")
+	// Browsers only send the origin of forms checked in recentHandle if the referrer is allowed
+	rw.Header().Set("Referrer-Policy", "same-origin")
+	td := landingTemplateStruct{
+		Translation: requestTranslation(rw, r),
+		ShowRecent:  config.LandingPage,
+		InvalidName: invalidName,
+		Languages:   languageOptions(),
+		ServerPath:  config.ServerPath,
+	}
+	td.Templates = templateOptions(td.Translation)
+	if td.ShowRecent {
+		td.Recent = recentOptions(r, requestIdentity(r))
+	}
+	if invalidName {
+		rw.WriteHeader(http.StatusBadRequest)
+	}
+	td.FooterLinks = footerLinks(td.Translation)
+	err := landingTemplate.Execute(rw, td)
+	if err != nil {
+		log.Println("landing template:", err)
+	}
+}
+
+// checkOrigin only allows websocket connections and forms from the configured origins.
+// If no origins are configured, only connections from the same origin are allowed.
+// Requests without an Origin header do not come from a browser and are allowed.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	if len(config.AllowedOrigins) == 0 {
+		if strings.EqualFold(u.Host, r.Host) {
+			return true
+		}
+		log.Printf("server: rejected request from origin '%s'", origin)
+		return false
+	}
+
+	origin = strings.ToLower(strings.Join([]string{u.Scheme, "://", u.Host}, ""))
+	for i := range config.AllowedOrigins {
+		if config.AllowedOrigins[i] == "*" || config.AllowedOrigins[i] == origin {
+			return true
+		}
+	}
+	log.Printf("server: rejected request from origin '%s'", origin)
+	return false
+}
+
+// setSecurityHeaders sets headers restricting what browsers allow a page to do.
+// Inline scripts are only allowed with the given nonce. If nonce is empty, no inline scripts are allowed.
+func setSecurityHeaders(rw http.ResponseWriter, r *http.Request, nonce string) {
+	script := "'self'"
+	if nonce != "" {
+		script = strings.Join([]string{script, " 'nonce-", nonce, "'"}, "")
+	}
+	img := "'self' data:"
+	if config.AllowExternalImages {
+		img = strings.Join([]string{img, " http: https:"}, "")
+	}
+	csp := strings.Join([]string{
+		"default-src 'self'",
+		strings.Join([]string{"script-src ", script}, ""),
+		"style-src 'self' 'unsafe-inline'", // Quill and KaTeX use inline styles
+		strings.Join([]string{"img-src ", img}, ""),
+		strings.Join([]string{"connect-src 'self' ws://", r.Host, " wss://", r.Host}, ""),
+		"object-src 'none'",
+		"base-uri 'none'",
+		"form-action 'self'",
+		"frame-ancestors 'none'",
+	}, "; ")
+
+	h := rw.Header()
+	h.Set("Content-Security-Policy", csp)
+	h.Set("X-Frame-Options", "DENY")
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Referrer-Policy", "no-referrer") // The path of a document is all you need to access it
+}
+
+// countingListener wraps all accepted connections into a countingConn.
+type countingListener struct {
+	net.Listener
+}
+
+func (l countingListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &countingConn{Conn: c}, nil
+}
+
+// countingConn counts the bytes written to a connection.
+// It is used to measure the effect of websocket compression.
+type countingConn struct {
+	net.Conn
+	written atomic.Int64
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.written.Add(int64(n))
+	return n, err
+}
+
+// writtenBytes returns the number of bytes written to the underlying connection of the websocket.
+// It returns -1 if the number is unknown.
+func writtenBytes(conn *websocket.Conn) int64 {
+	c, ok := conn.NetConn().(*countingConn)
+	if !ok {
+		return -1
+	}
+	return c.written.Load()
+}
+
 // RunServer starts the actual server.
 // It does nothing if a server is already started.
 // It will return directly after the server is started.
@@ -289,13 +572,26 @@ func RunServer() {
 	}
 	log.Println("server: Server starting at", config.Address)
 	serverStarted = true
+	upgrader.EnableCompression = config.Compression
+
+	addr := server.Addr
+	if addr == "" {
+		addr = ":http"
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Panicln("server:", err)
+	}
 	go func() {
-		err = server.ListenAndServe()
+		err := server.Serve(countingListener{ln})
 		if err != http.ErrServerClosed {
 			log.Println("server:", err)
 		}
 	}()
 	go serverGCWorker()
+	go textPagesReloadWorker()
+	go clusterLeaseWorker()
+	go tokenCheckWorker()
 }
 
 // StopServer shuts the server down.
@@ -313,18 +609,38 @@ func StopServer() {
 	} else {
 		log.Println("server:", err)
 	}
-	stopGC <- true
+	close(stopGC)
+	close(stopPagesReload)
+	close(stopTokenCheck)
+	if leaser != nil {
+		close(stopCluster)
+	}
 
+	writerMapLock.Lock()
+	writers := make(map[string]*writer, len(writerMap))
 	for k := range writerMap {
-		err := writerMap[k].Delete()
-		if err != nil {
-			log.Printf("server: error while deleting %s: %s", k, err.Error())
-		}
+		writers[k] = writerMap[k]
 	}
+	writerMapLock.Unlock()
+
+	log.Printf("server: draining %d writers", len(writers))
+	timeout := time.Duration(config.ShutdownTimeoutSeconds) * time.Second
+	var wg sync.WaitGroup
+	for k := range writers {
+		wg.Add(1)
+		go func(k string, w *writer) {
+			defer wg.Done()
+			err := w.Drain(timeout)
+			if err != nil {
+				log.Printf("server: error while draining %s: %s", k, err.Error())
+			}
+		}(k, writers[k])
+	}
+	wg.Wait()
 }
 
 func serverGCWorker() {
-	if config.GCMinutes <= 0 {
+	if gcInterval() <= 0 {
 		// no gc
 		return
 	}
@@ -332,25 +648,43 @@ func serverGCWorker() {
 	log.Println("gc:", "worker started")
 
 	for {
-		t := time.NewTicker(time.Duration(config.GCMinutes) * time.Minute)
+		t := time.NewTicker(gcInterval())
 		select {
 		case <-stopGC:
 			return
 		case <-t.C:
-			writerMapLock.Lock()
-			log.Println("gc:", "begin gc")
-			for k := range writerMap {
-				if writerMap[k].CanBeDeleted() {
-					log.Println("gc:", "removed", k)
-					err := writerMap[k].Delete()
-					if err != nil {
-						log.Printf("server: error while deleting %s: %s", k, err.Error())
-					}
-					delete(writerMap, k)
-				}
-			}
-			log.Println("gc:", "finished gc")
-			writerMapLock.Unlock()
+			collectWriters()
+		}
+	}
+}
+
+// collectWriters removes all writers without connections and saves them.
+// The writers are saved without holding writerMapLock, so a slow DataSafe does not block opening other documents.
+func collectWriters() {
+	log.Println("gc:", "begin gc")
+	writerMapLock.Lock()
+	removed := make(map[string]*writer)
+	for k := range writerMap {
+		if writerMap[k].CanBeDeleted() {
+			removed[k] = writerMap[k]
+			delete(writerMap, k)
+			writerDeleting[k] = make(chan struct{})
+		}
+	}
+	// Documents claimed by loading their page are kept until the next run, so their websocket can be opened
+	forgetMemoryACLs(func(key string) bool { return writerMap[key] != nil }, gcInterval())
+	writerMapLock.Unlock()
+
+	for k := range removed {
+		log.Println("gc:", "removed", k)
+		err := removed[k].Delete()
+		if err != nil {
+			log.Printf("server: error while deleting %s: %s", k, err.Error())
 		}
+		writerMapLock.Lock()
+		close(writerDeleting[k])
+		delete(writerDeleting, k)
+		writerMapLock.Unlock()
 	}
+	log.Println("gc:", "finished gc")
 }
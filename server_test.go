@@ -0,0 +1,133 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/Top-Ranger/writergo/registry"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	testGlobals()
+
+	tests := []struct {
+		name    string
+		origin  string
+		host    string
+		allowed []string
+		want    bool
+	}{
+		{"no origin", "", "writer.example", nil, true},
+		{"same host", "https://writer.example", "writer.example", nil, true},
+		{"same host and port", "http://writer.example:8782", "writer.example:8782", nil, true},
+		{"different port", "https://writer.example:8443", "writer.example", nil, false},
+		{"different case", "https://Writer.EXAMPLE", "writer.example", nil, true},
+		{"other host", "https://evil.example", "writer.example", nil, false},
+		{"host as suffix", "https://writer.example.evil.example", "writer.example", nil, false},
+		{"invalid origin", "https://%zz", "writer.example", nil, false},
+		{"listed origin", "https://app.example", "writer.example", []string{"https://app.example"}, true},
+		{"listed origin in other case", "HTTPS://App.Example", "writer.example", []string{"https://app.example"}, true},
+		{"listed origin with other scheme", "http://app.example", "writer.example", []string{"https://app.example"}, false},
+		{"unlisted origin", "https://evil.example", "writer.example", []string{"https://app.example"}, false},
+		{"same host not listed", "https://writer.example", "writer.example", []string{"https://app.example"}, false},
+		{"wildcard", "https://evil.example", "writer.example", []string{"*"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := config.AllowedOrigins
+			config.AllowedOrigins = tt.allowed
+			defer func() { config.AllowedOrigins = old }()
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Host = tt.host
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if got := checkOrigin(r); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	testGlobals()
+
+	tests := []struct {
+		name  string
+		nonce string
+	}{
+		{"without nonce", ""},
+		{"with nonce", "abc123"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Host = "writer.example"
+			setSecurityHeaders(rec, r, tt.nonce)
+
+			h := rec.Header()
+			if h.Get("X-Frame-Options") != "DENY" || h.Get("X-Content-Type-Options") != "nosniff" || h.Get("Referrer-Policy") != "no-referrer" {
+				t.Errorf("missing security headers: %v", h)
+			}
+			csp := h.Get("Content-Security-Policy")
+			for _, want := range []string{"frame-ancestors 'none'", "object-src 'none'", "connect-src 'self' ws://writer.example wss://writer.example"} {
+				if !strings.Contains(csp, want) {
+					t.Errorf("CSP '%s' does not contain '%s'", csp, want)
+				}
+			}
+			if hasNonce := strings.Contains(csp, "'nonce-"); hasNonce != (tt.nonce != "") || !strings.Contains(csp, tt.nonce) {
+				t.Errorf("CSP '%s' has wrong nonce, want '%s'", csp, tt.nonce)
+			}
+			if strings.Contains(csp, "'unsafe-inline'") && !strings.Contains(csp, "style-src 'self' 'unsafe-inline'") {
+				t.Errorf("CSP '%s' allows inline scripts", csp)
+			}
+		})
+	}
+}
+
+func TestDocumentPageNonce(t *testing.T) {
+	testGlobals()
+	key := t.Name()
+	nonces := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, strings.Join([]string{"/", key}, ""), nil)
+		rootHandle(rec, r.WithContext(context.WithValue(r.Context(), identityContextKey{}, registry.Identity{})))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got status %d", rec.Code)
+		}
+
+		m := regexp.MustCompile(`'nonce-([^']+)'`).FindStringSubmatch(rec.Header().Get("Content-Security-Policy"))
+		if m == nil {
+			t.Fatalf("no nonce in CSP '%s'", rec.Header().Get("Content-Security-Policy"))
+		}
+		if !strings.Contains(rec.Body.String(), strings.Join([]string{`<script nonce="`, m[1], `">`}, "")) {
+			t.Errorf("script does not use nonce %s", m[1])
+		}
+		nonces[m[1]] = true
+	}
+	if len(nonces) != 2 {
+		t.Error("nonce is reused")
+	}
+}
@@ -0,0 +1,262 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Top-Ranger/writergo/registry"
+	"github.com/gorilla/websocket"
+)
+
+// Scopes of API tokens.
+const (
+	scopeRead  = "read"
+	scopeWrite = "write"
+	scopeAdmin = "admin"
+)
+
+// scopeRole is the highest role a scope grants on a document.
+// The role granted by the ACL of the document is never exceeded.
+var scopeRole = map[string]string{
+	scopeRead:  roleViewer,
+	scopeWrite: roleEditor,
+	scopeAdmin: roleOwner,
+}
+
+// apiTokenPrefix is the prefix of all API tokens, so they can be recognised (e.g. by secret scanners).
+const apiTokenPrefix = "wgo_"
+
+// tokenStore stores the API tokens. It is nil if the DataSafe does not support API tokens.
+var tokenStore registry.TokenStore
+
+// scopeLimit returns the highest role the scopes of an API token allow.
+// Identities without scopes are not limited.
+func scopeLimit(scopes []string) string {
+	if len(scopes) == 0 {
+		return roleOwner
+	}
+	limit := roleNone
+	for _, s := range scopes {
+		if r, ok := scopeRole[s]; ok && hasRole(r, limit) {
+			limit = r
+		}
+	}
+	return limit
+}
+
+// parseScopes parses a comma separated list of scopes.
+func parseScopes(s string) ([]string, error) {
+	var scopes []string
+	for _, scope := range strings.Split(s, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope == "" {
+			continue
+		}
+		if _, ok := scopeRole[scope]; !ok {
+			return nil, fmt.Errorf("unknown scope '%s' (must be '%s', '%s' or '%s')", scope, scopeRead, scopeWrite, scopeAdmin)
+		}
+		scopes = append(scopes, scope)
+	}
+	if len(scopes) == 0 {
+		return nil, errors.New("no scope given")
+	}
+	return scopes, nil
+}
+
+// hashToken returns the hash an API token is stored under.
+// Tokens are random and long, so a fast hash is sufficient.
+func hashToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// createToken creates and stores a new API token for the user.
+// The returned token is not stored and can not be recovered later.
+func createToken(user string, scopes []string) (string, registry.APIToken, error) {
+	b := make([]byte, 40)
+	_, err := io.ReadFull(rand.Reader, b)
+	if err != nil {
+		return "", registry.APIToken{}, fmt.Errorf("can not create random token: %w", err)
+	}
+	id := hex.EncodeToString(b[:8])
+	token := strings.Join([]string{apiTokenPrefix, id, "_", base64.RawURLEncoding.EncodeToString(b[8:])}, "")
+
+	t := registry.APIToken{
+		ID:      id,
+		Hash:    hashToken(token),
+		User:    user,
+		Scopes:  scopes,
+		Created: time.Now(),
+	}
+	err = tokenStore.SaveToken(t)
+	if err != nil {
+		return "", registry.APIToken{}, fmt.Errorf("can not save token: %w", err)
+	}
+	return token, t, nil
+}
+
+// bearerToken returns the API token sent in the Authorization header.
+// The bool indicates whether the request contains a bearer token.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// tokenIdentity returns the identity of the user an API token acts as.
+// The bool indicates whether the token is valid.
+func tokenIdentity(token string) (registry.Identity, bool) {
+	if tokenStore == nil || !strings.HasPrefix(token, apiTokenPrefix) {
+		return registry.Identity{}, false
+	}
+	t, ok, err := tokenStore.LoadToken(hashToken(token))
+	if err != nil {
+		log.Println("token: can not load token:", err)
+		return registry.Identity{}, false
+	}
+	if !ok || t.User == "" || len(t.Scopes) == 0 {
+		return registry.Identity{}, false
+	}
+	return registry.Identity{User: t.User, Name: t.User, Scopes: t.Scopes, Token: t.Hash}, true
+}
+
+// tokenCheckInterval is the interval in which open connections are checked for revoked API tokens.
+// Tokens are revoked from the command line, so the server has to ask the DataSafe.
+const tokenCheckInterval = time.Minute
+
+var stopTokenCheck = make(chan struct{})
+
+// tokenCheckWorker closes all connections authenticated with API tokens which were revoked.
+func tokenCheckWorker() {
+	if tokenStore == nil {
+		return
+	}
+
+	t := time.NewTicker(tokenCheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stopTokenCheck:
+			return
+		case <-t.C:
+			closeRevokedTokens()
+		}
+	}
+}
+
+// closeRevokedTokens closes all connections of all writers authenticated with API tokens which no longer exist.
+func closeRevokedTokens() {
+	writerMapLock.Lock()
+	writers := make([]*writer, 0, len(writerMap))
+	for k := range writerMap {
+		writers = append(writers, writerMap[k])
+	}
+	writerMapLock.Unlock()
+
+	revoked := make(map[string]bool)
+	for _, w := range writers {
+		w.l.Lock()
+		for _, c := range w.connections {
+			if c.identity.Token != "" {
+				revoked[c.identity.Token] = false
+			}
+		}
+		w.l.Unlock()
+	}
+	if len(revoked) == 0 {
+		return
+	}
+
+	// The DataSafe is not queried while holding the locks of the writers
+	for hash := range revoked {
+		_, ok, err := tokenStore.LoadToken(hash)
+		if err != nil {
+			log.Println("token: can not check token:", err)
+			continue
+		}
+		revoked[hash] = !ok
+	}
+	for _, w := range writers {
+		w.closeRevokedTokens(revoked)
+	}
+}
+
+// closeRevokedTokens closes all connections authenticated with an API token marked as revoked.
+func (w *writer) closeRevokedTokens(revoked map[string]bool) {
+	w.l.Lock()
+	defer w.l.Unlock()
+	for k, c := range w.connections {
+		if c.identity.Token != "" && revoked[c.identity.Token] {
+			log.Println(w.Key, k, "API token revoked")
+			w.sendError(k, errorForbidden, websocket.ClosePolicyViolation)
+		}
+	}
+}
+
+// runTokenCommand creates, lists or revokes API tokens from the command line.
+func runTokenCommand(w io.Writer, create, scopes string, list bool, revoke string) error {
+	if tokenStore == nil {
+		return fmt.Errorf("DataSafe '%s' does not support API tokens", config.DataSafe)
+	}
+
+	switch {
+	case create != "":
+		s, err := parseScopes(scopes)
+		if err != nil {
+			return err
+		}
+		token, t, err := createToken(create, s)
+		if err != nil {
+			return err
+		}
+		log.Printf("token: created token '%s' for user '%s' with scopes '%s'", t.ID, t.User, strings.Join(t.Scopes, ","))
+		_, err = fmt.Fprintln(w, token)
+		return err
+	case list:
+		tokens, err := tokenStore.ListTokens()
+		if err != nil {
+			return err
+		}
+		for i := range tokens {
+			_, err = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", tokens[i].ID, tokens[i].User, strings.Join(tokens[i].Scopes, ","), tokens[i].Created.Format(time.RFC3339))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case revoke != "":
+		err := tokenStore.DeleteToken(revoke)
+		if err != nil {
+			return err
+		}
+		log.Printf("token: revoked token '%s'", revoke)
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/Top-Ranger/writergo/registry"
+	"github.com/gorilla/websocket"
+)
+
+// testTokenStore stores API tokens in memory. It must not be changed while in use.
+type testTokenStore map[string]registry.APIToken
+
+func (s testTokenStore) SaveToken(t registry.APIToken) error {
+	s[t.Hash] = t
+	return nil
+}
+
+func (s testTokenStore) LoadToken(hash string) (registry.APIToken, bool, error) {
+	t, ok := s[hash]
+	return t, ok, nil
+}
+
+func (s testTokenStore) ListTokens() ([]registry.APIToken, error) {
+	tokens := make([]registry.APIToken, 0, len(s))
+	for _, t := range s {
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
+
+func (s testTokenStore) DeleteToken(id string) error {
+	for h, t := range s {
+		if t.ID == id {
+			delete(s, h)
+			return nil
+		}
+	}
+	return registry.ErrUnknownToken
+}
+
+func TestCloseRevokedTokens(t *testing.T) {
+	_, w := testWriter(t)
+	tokenStore = testTokenStore{"valid": {ID: "1", Hash: "valid", User: "bot", Scopes: []string{scopeRead}}}
+	t.Cleanup(func() { tokenStore = nil })
+	writerMapLock.Lock()
+	writerMap[w.Key] = w
+	writerMapLock.Unlock()
+	t.Cleanup(func() {
+		writerMapLock.Lock()
+		delete(writerMap, w.Key)
+		writerMapLock.Unlock()
+	})
+
+	connections := map[string]*connection{
+		"valid":   testConnection(t, w, "valid"),
+		"revoked": testConnection(t, w, "revoked"),
+		"login":   testConnection(t, w, "login"),
+	}
+	w.l.Lock()
+	connections["valid"].identity = registry.Identity{User: "bot", Scopes: []string{scopeRead}, Token: "valid"}
+	connections["revoked"].identity = registry.Identity{User: "bot", Scopes: []string{scopeRead}, Token: "revoked"}
+	connections["login"].identity = registry.Identity{User: "alice"}
+	w.l.Unlock()
+
+	closeRevokedTokens()
+
+	for key, c := range connections {
+		var queued []command
+		for len(c.send) > 0 {
+			queued = append(queued, <-c.send)
+		}
+		if key != "revoked" {
+			if len(queued) != 0 {
+				t.Errorf("%s: got %+v, want nothing", key, queued)
+			}
+			continue
+		}
+		if len(queued) != 2 || queued[0].Data != errorForbidden || queued[1].closeCode != websocket.ClosePolicyViolation {
+			t.Errorf("%s: got %+v, want error and close", key, queued)
+		}
+	}
+}
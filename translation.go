@@ -18,9 +18,15 @@ package main
 import (
 	"embed"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
 	"log"
+	"os"
+	"path"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
 )
@@ -28,6 +34,7 @@ import (
 // Translation represents an object holding all translations
 type Translation struct {
 	Language                                  string
+	LanguageName                              string
 	CreatedBy                                 string
 	Impressum                                 string
 	PrivacyPolicy                             string
@@ -41,6 +48,43 @@ type Translation struct {
 	ButtonDownloadHTML                        string
 	ButtonDownloadDelta                       string
 	ButtonUploadDelta                         string
+	ResumeConflict                            string
+	ErrorMessageTooLarge                      string
+	ErrorDocumentTooLarge                     string
+	ErrorInvalidDocument                      string
+	Maintenance                               string
+	ReadOnly                                  string
+	ButtonShare                               string
+	ShareTitle                                string
+	ShareName                                 string
+	ShareRole                                 string
+	ShareUser                                 string
+	ShareGroup                                string
+	SharePublic                               string
+	ShareAdd                                  string
+	ShareRemove                               string
+	ShareSave                                 string
+	ShareCancel                               string
+	RoleNone                                  string
+	RoleViewer                                string
+	RoleCommenter                             string
+	RoleEditor                                string
+	RoleOwner                                 string
+	ErrorForbidden                            string
+	ErrorInvalidACL                           string
+	ErrorRateLimited                          string
+	NewDocument                               string
+	NewDocumentText                           string
+	NewEmptyDocument                          string
+	NewDocumentName                           string
+	NewDocumentTemplate                       string
+	ButtonCreate                              string
+	ErrorInvalidName                          string
+	RecentDocuments                           string
+	NoRecentDocuments                         string
+	ButtonPin                                 string
+	ButtonUnpin                               string
+	ButtonForget                              string
 }
 
 const defaultLanguage = "en"
@@ -52,15 +96,29 @@ var initialiseCurrent sync.Once
 var current Translation
 var rwlock sync.RWMutex
 var translationPath = "./translation"
+var loadedTranslations = make(map[string]Translation)
+
+// translationDirectory contains additional translation files, which override the embedded ones.
+// It is set through LoadTranslations.
+var translationDirectory string
 
 // GetTranslation returns a Translation struct of the given language.
 // This function always loads translations from disk. Try to use GetDefaultTranslation where possible.
 func GetTranslation(language string) (Translation, error) {
-	t, err := getSingleTranslation(language)
+	rwlock.RLock()
+	dir := translationDirectory
+	rwlock.RUnlock()
+	return loadTranslation(language, dir)
+}
+
+// loadTranslation returns a Translation struct of the given language using the additional translations in dir.
+// Missing strings are taken from the default language.
+func loadTranslation(language, dir string) (Translation, error) {
+	t, err := getSingleTranslation(language, dir)
 	if err != nil {
 		return Translation{}, err
 	}
-	d, err := getSingleTranslation(defaultLanguage)
+	d, err := getSingleTranslation(defaultLanguage, dir)
 	if err != nil {
 		return Translation{}, err
 	}
@@ -84,26 +142,126 @@ func GetTranslation(language string) (Translation, error) {
 	return t, nil
 }
 
-func getSingleTranslation(language string) (Translation, error) {
+// getSingleTranslation returns the strings of the language without falling back to the default language.
+// Strings in dir override the embedded ones.
+func getSingleTranslation(language, dir string) (Translation, error) {
 	if language == "" {
 		return GetDefaultTranslation(), nil
 	}
+	if strings.ContainsAny(language, `/\.`) {
+		return Translation{}, fmt.Errorf("invalid language '%s'", language)
+	}
 
 	file := strings.Join([]string{language, "json"}, ".")
-	file = filepath.Join(translationPath, file)
+	found := false
+	t := Translation{}
 
-	b, err := translationFiles.ReadFile(file)
-	if err != nil {
+	b, err := translationFiles.ReadFile(filepath.Join(translationPath, file))
+	if err == nil {
+		err = json.Unmarshal(b, &t)
+		if err != nil {
+			return Translation{}, err
+		}
+		found = true
+	} else if !errors.Is(err, fs.ErrNotExist) {
 		return Translation{}, err
 	}
-	t := Translation{}
-	err = json.Unmarshal(b, &t)
-	if err != nil {
-		return Translation{}, err
+
+	if dir != "" {
+		b, err := os.ReadFile(filepath.Join(dir, file))
+		if err == nil {
+			// Only the strings contained in the file are replaced
+			err = json.Unmarshal(b, &t)
+			if err != nil {
+				return Translation{}, fmt.Errorf("can not parse %s: %w", filepath.Join(dir, file), err)
+			}
+			found = true
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return Translation{}, err
+		}
+	}
+
+	if !found {
+		return Translation{}, fmt.Errorf("unknown language '%s'", language)
 	}
 	return t, nil
 }
 
+// translationLanguages returns all languages with an embedded translation or a translation in dir.
+func translationLanguages(dir string) ([]string, error) {
+	entries, err := translationFiles.ReadDir(path.Clean(translationPath))
+	if err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		external, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("can not read translation directory: %w", err)
+		}
+		entries = append(entries, external...)
+	}
+
+	seen := make(map[string]bool)
+	languages := make([]string, 0, len(entries))
+	for i := range entries {
+		language, ok := strings.CutSuffix(entries[i].Name(), ".json")
+		if !ok || entries[i].IsDir() || seen[language] || strings.HasPrefix(language, ".") {
+			continue
+		}
+		seen[language] = true
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages, nil
+}
+
+// LoadTranslations loads the translations of all available languages.
+// Translation files in dir add further languages or override strings of the embedded translations. dir may be empty.
+// The translations are used through AvailableLanguages and GetLoadedTranslation.
+// Nothing is changed if it returns error != nil.
+func LoadTranslations(dir string) error {
+	languages, err := translationLanguages(dir)
+	if err != nil {
+		return err
+	}
+
+	loaded := make(map[string]Translation, len(languages))
+	for _, language := range languages {
+		t, err := loadTranslation(language, dir)
+		if err != nil {
+			return fmt.Errorf("can not load translation '%s': %w", language, err)
+		}
+		loaded[language] = t
+	}
+
+	rwlock.Lock()
+	defer rwlock.Unlock()
+	loadedTranslations = loaded
+	translationDirectory = dir
+	return nil
+}
+
+// AvailableLanguages returns all languages loaded through LoadTranslations in alphabetical order.
+func AvailableLanguages() []string {
+	rwlock.RLock()
+	defer rwlock.RUnlock()
+	languages := make([]string, 0, len(loadedTranslations))
+	for l := range loadedTranslations {
+		languages = append(languages, l)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// GetLoadedTranslation returns the translation of a language loaded through LoadTranslations.
+// The bool indicates whether the language is available.
+func GetLoadedTranslation(language string) (Translation, bool) {
+	rwlock.RLock()
+	defer rwlock.RUnlock()
+	t, ok := loadedTranslations[language]
+	return t, ok
+}
+
 // SetDefaultTranslation sets the default language to the provided one.
 // Does nothing if it returns error != nil.
 func SetDefaultTranslation(language string) error {
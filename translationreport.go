@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// translationKeys returns the names of all strings of the Translation struct.
+func translationKeys() []string {
+	t := reflect.TypeOf(Translation{})
+	keys := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Type.Kind() == reflect.String {
+			keys = append(keys, t.Field(i).Name)
+		}
+	}
+	return keys
+}
+
+// translationFileKeys returns all non-empty strings of a translation file.
+// The bool indicates whether the file exists.
+func translationFileKeys(read func(string) ([]byte, error), file string) (map[string]bool, bool, error) {
+	b, err := read(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var content map[string]interface{}
+	err = json.Unmarshal(b, &content)
+	if err != nil {
+		return nil, false, fmt.Errorf("can not parse %s: %w", file, err)
+	}
+	keys := make(map[string]bool, len(content))
+	for k, v := range content {
+		if s, ok := v.(string); !ok || s != "" {
+			keys[k] = true
+		}
+	}
+	return keys, true, nil
+}
+
+// translationReport writes the coverage of all translations (embedded and in dir) to w.
+// For each language, the strings which are missing (and replaced by the default language) and the unknown strings are listed.
+func translationReport(w io.Writer, dir string) error {
+	languages, err := translationLanguages(dir)
+	if err != nil {
+		return err
+	}
+	keys := translationKeys()
+
+	for _, language := range languages {
+		file := strings.Join([]string{language, "json"}, ".")
+
+		var sources []string
+		present := make(map[string]bool)
+		var unknown []string
+		add := func(read func(string) ([]byte, error), path, source string) error {
+			k, ok, err := translationFileKeys(read, path)
+			if err != nil || !ok {
+				return err
+			}
+			sources = append(sources, source)
+			for key := range k {
+				present[key] = true
+			}
+			return nil
+		}
+		err = add(translationFiles.ReadFile, filepath.Join(translationPath, file), "embedded")
+		if err != nil {
+			return err
+		}
+		if dir != "" {
+			err = add(os.ReadFile, filepath.Join(dir, file), filepath.Join(dir, file))
+			if err != nil {
+				return err
+			}
+		}
+
+		var missing []string
+		known := make(map[string]bool, len(keys))
+		for _, k := range keys {
+			known[k] = true
+			if !present[k] {
+				missing = append(missing, k)
+			}
+		}
+		for k := range present {
+			if !known[k] {
+				unknown = append(unknown, k)
+			}
+		}
+		sort.Strings(unknown)
+
+		_, err = fmt.Fprintf(w, "%s (%s): %d/%d strings (%.1f%%)\n", language, strings.Join(sources, ", "), len(keys)-len(missing), len(keys), 100*float64(len(keys)-len(missing))/float64(len(keys)))
+		if err != nil {
+			return err
+		}
+		if len(missing) != 0 {
+			_, err = fmt.Fprintf(w, "\tmissing: %s\n", strings.Join(missing, ", "))
+			if err != nil {
+				return err
+			}
+		}
+		if len(unknown) != 0 {
+			_, err = fmt.Fprintf(w, "\tunknown: %s\n", strings.Join(unknown, ", "))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
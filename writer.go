@@ -17,11 +17,19 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/Top-Ranger/writergo/registry"
 	"github.com/gorilla/websocket"
 )
 
@@ -32,13 +40,50 @@ const (
 	commandAskWrite    = "write"
 	commandGetWrite    = "can_write"
 	commandStopWrite   = "can_not_write"
+	commandConflict    = "conflict"
+	commandError       = "error"
+	commandShutdown    = "shutdown"
+	commandRole        = "role"
+	commandGetACL      = "get_acl"
+	commandSetACL      = "set_acl"
+	commandACL         = "acl"
+	commandExported    = "exported"
+	commandNormalised  = "normalised"
 )
 
+// Formats a client can report with commandExported.
+const (
+	exportHTML  = "html"
+	exportDelta = "delta"
+)
+
+// Error codes sent with commandError.
+// The client is responsible for displaying them.
+const (
+	errorMessageTooLarge  = "message_too_large"
+	errorDocumentTooLarge = "document_too_large"
+	errorInvalidDocument  = "invalid_document"
+	errorForbidden        = "forbidden"
+	errorInvalidACL       = "invalid_acl"
+	errorRateLimited      = "rate_limited"
+)
+
+const (
+	overflowResync     = "resync"
+	overflowDisconnect = "disconnect"
+)
+
+// writeTimeout is the maximum time a single message may take to be written to a connection.
+const writeTimeout = 30 * time.Second
+
+// drainCloseTimeout is the maximum time Drain waits for the connections to be closed.
+const drainCloseTimeout = 2 * time.Second
+
 type writer struct {
 	Key string
 
 	l           sync.Mutex
-	connections map[string]*websocket.Conn
+	connections map[string]*connection
 	counter     int
 	ctx         context.Context
 	cancel      context.CancelFunc
@@ -49,51 +94,175 @@ type writer struct {
 	active string
 
 	changeActiveLock sync.Mutex
+
+	draining   bool
+	finalState chan struct{} // closed when the active connection sent its final state while draining
+
+	sessions    map[string]*session // session token -> session
+	connSession map[string]string   // connection key -> session token
+
+	revision         int
+	revisionAuthor   string // session token of the author of the latest revision
+	revisionRunStart int    // first revision the author based its current run of changes on
+
+	version       string          // version of the state in the DataSafe, if supported
+	savedRevision int             // latest revision saved to the DataSafe
+	editors       map[string]bool // users who changed the state since the last save, "" for anonymous users
+
+	stats compressionStats
+
+	sub         registry.Subscription
+	remoteUsers map[string]int // instance -> number of connections
+}
+
+// compressionStats collects statistics about the traffic sent to the clients of a writer.
+type compressionStats struct {
+	messages   atomic.Int64
+	compressed atomic.Int64
+	rawBytes   atomic.Int64
+	sentBytes  atomic.Int64
+}
+
+// connection represents a single client connection.
+// All messages to the client are sent by a dedicated goroutine from a bounded queue,
+// so a slow client does not block the other clients of a writer.
+type connection struct {
+	conn     *websocket.Conn
+	send     chan command
+	done     chan struct{}
+	identity registry.Identity
+	role     string
+	remote   string // IP address of the client
+}
+
+// session represents the identity of a client across reconnects.
+type session struct {
+	key  string    // current connection key
+	left time.Time // zero while connected
+	user string    // authenticated user who created the session
 }
 
 type command struct {
-	Comm string
-	Data string
+	Comm     string
+	Data     string
+	Session  string `json:",omitempty"`
+	Revision int    `json:",omitempty"`
+	Sequence int    `json:",omitempty"` // number of a state sent by a client, returned with commandNormalised
+
+	closeCode int // if not 0, the connection is closed with this code instead of sending the command
 }
 
 func (w *writer) Init() error {
 	var err error
-	w.current, err = ds.LoadWriter(w.Key)
+	if vds, ok := ds.(registry.VersionedDataSafe); ok {
+		w.current, w.version, err = vds.LoadWriterVersion(w.Key)
+	} else {
+		w.current, err = ds.LoadWriter(w.Key)
+	}
 	if err != nil {
 		log.Println(w.Key, "can not read initial state:", err)
 	}
-	w.connections = make(map[string]*websocket.Conn)
+	w.connections = make(map[string]*connection)
+	w.sessions = make(map[string]*session)
+	w.connSession = make(map[string]string)
+	w.remoteUsers = make(map[string]int)
+	w.editors = make(map[string]bool)
 	w.ctx, w.cancel = context.WithCancel(context.Background())
+	w.sub, err = messageBus.Subscribe(busTopic(w.Key), w.handleBusMessage)
+	if err != nil {
+		log.Println(w.Key, "can not subscribe to bus:", err)
+	}
+	w.publish(busMessage{Type: busSyncRequest})
 	go w.backupWorker()
 	return nil
 }
 
-func (w *writer) AddNew(conn *websocket.Conn) error {
+// AddNew adds a connection of an authenticated user with the given role on the document to the writer.
+// client is the IP address of the user.
+// If token names a session of the same user which is still connected or left within the grace window, the connection resumes that session,
+// including the write permission if the session held it and the user is still an editor. Otherwise a new session is created.
+func (w *writer) AddNew(conn *websocket.Conn, token string, identity registry.Identity, role, client string) error {
 	w.l.Lock()
 	defer w.l.Unlock()
 
 	key := strconv.Itoa(w.counter)
 	w.counter++
 
-	w.currentL.Lock()
-	current := w.current
-	w.currentL.Unlock()
-	c := command{Comm: commandInitialSend, Data: current}
-	err := conn.WriteJSON(&c)
-	if err != nil {
-		if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
-			log.Println(w.Key, key, "send initial state:", err)
+	w.expireSessions()
+
+	resumeWrite := false
+	s := w.sessions[token]
+	if token != "" && s != nil && s.user == identity.User {
+		old := s.key
+		if oldConn := w.connections[old]; oldConn != nil {
+			// The client is back before we noticed that the old connection died
+			w.auditConnection(auditClose, old, "replaced by reconnect")
+			w.closeConnection(oldConn)
+			delete(w.connections, old)
+			delete(w.connSession, old)
 		}
-		return err
+		if w.active == old {
+			if hasRole(role, roleEditor) {
+				w.active = key
+				resumeWrite = true
+			} else {
+				w.active = ""
+			}
+		}
+		s.key = key
+		s.left = time.Time{}
+		log.Println(w.Key, "resumed:", old, "as", key)
+	} else {
+		token = RandomString()
+		s = &session{key: key, user: identity.User}
+		w.sessions[token] = s
+	}
+	w.connSession[key] = token
+
+	// Messages are limited in writerWorker to be able to report the error to the client.
+	// This limit only guards against clients ignoring the error.
+	conn.SetReadLimit(2 * config.MaxMessageBytes)
+
+	if config.Compression {
+		err := conn.SetCompressionLevel(config.CompressionLevel)
+		if err != nil {
+			log.Println(w.Key, key, "set compression level:", err)
+		}
+	}
+
+	c := &connection{
+		conn:     conn,
+		send:     make(chan command, config.SendQueueSize),
+		done:     make(chan struct{}),
+		identity: identity,
+		role:     role,
+		remote:   client,
 	}
+	w.connections[key] = c
+	go w.sendWorker(key, c)
+	w.auditConnection(auditOpen, key, role)
 
-	go writerWorker(conn, key, w)
+	// The role is sent first, since a resuming client expects commandGetWrite directly after the initial state
+	w.send(key, command{Comm: commandRole, Data: role})
+	w.currentL.Lock()
+	w.send(key, command{Comm: commandInitialSend, Data: w.current, Session: token, Revision: w.revision})
+	w.currentL.Unlock()
+
+	if resumeWrite {
+		w.send(key, command{Comm: commandGetWrite})
+		w.auditConnection(auditWriteToken, key, "resumed")
+	}
 
-	w.connections[key] = conn
+	go writerWorker(conn, key, client, w)
 
-	log.Println(w.Key, "added:", key)
+	if identity.Anonymous() {
+		log.Println(w.Key, "added:", key)
+	} else {
+		log.Println(w.Key, "added:", key, "user:", identity.User)
+	}
 
-	w.push(command{Comm: commandNumberUser, Data: strconv.Itoa(len(w.connections))}, "")
+	w.broadcastUsers()
+	w.publish(busMessage{Type: busUsers, Users: len(w.connections)})
 
 	return nil
 }
@@ -103,20 +272,174 @@ func (w *writer) Remove(key string) {
 		w.l.Lock()
 		defer w.l.Unlock()
 
-		conn := w.connections[key]
-		if conn != nil {
-			if err := conn.Close(); err != nil {
-				log.Println(w.Key, "close:", err)
-			}
+		c := w.connections[key]
+		if c == nil {
+			// Already removed
+			return
 		}
+		w.auditConnection(auditClose, key, "")
+		w.closeConnection(c)
 		delete(w.connections, key)
 
+		token := w.connSession[key]
+		if s := w.sessions[token]; s != nil && s.key == key {
+			s.left = time.Now()
+		}
+		delete(w.connSession, key)
+
 		log.Println(w.Key, "removed:", key)
 
-		w.push(command{Comm: commandNumberUser, Data: strconv.Itoa(len(w.connections))}, "")
+		w.broadcastUsers()
+		w.publish(busMessage{Type: busUsers, Users: len(w.connections)})
 	}()
 }
 
+// closeConnection stops the send worker of the connection and closes it.
+// Caller must hold w.l and must remove the connection from w.connections.
+func (w *writer) closeConnection(c *connection) {
+	close(c.done)
+	if err := c.conn.Close(); err != nil {
+		log.Println(w.Key, "close:", err)
+	}
+}
+
+// sendWorker writes all queued messages of a connection in order.
+func (w *writer) sendWorker(key string, c *connection) {
+	for {
+		select {
+		case data := <-c.send:
+			if data.closeCode != 0 {
+				err := c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(data.closeCode, data.Data), time.Now().Add(writeTimeout))
+				if err != nil && err != websocket.ErrCloseSent {
+					log.Println(w.Key, key, "write close:", err)
+				}
+				w.Remove(key)
+				return
+			}
+			b, err := json.Marshal(&data)
+			if err != nil {
+				log.Println(w.Key, key, "can not encode command:", err)
+				continue
+			}
+			compress := config.Compression && len(b) >= config.CompressionThresholdBytes
+			c.conn.EnableWriteCompression(compress)
+			c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			before := writtenBytes(c.conn)
+			err = c.conn.WriteMessage(websocket.TextMessage, b)
+			if err != nil {
+				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure, websocket.CloseServiceRestart) {
+					log.Println(w.Key, key, "write command:", err)
+				}
+				w.Remove(key)
+				return
+			}
+			w.stats.messages.Add(1)
+			if compress {
+				w.stats.compressed.Add(1)
+			}
+			w.stats.rawBytes.Add(int64(len(b)))
+			if before >= 0 {
+				w.stats.sentBytes.Add(writtenBytes(c.conn) - before)
+			} else {
+				w.stats.sentBytes.Add(int64(len(b)))
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// send queues a command for a single connection.
+// If the queue of the connection is full, config.SendQueueOverflow decides whether the connection is resynced or disconnected.
+// Caller must hold w.l.
+func (w *writer) send(key string, data command) {
+	c := w.connections[key]
+	if c == nil {
+		return
+	}
+
+	select {
+	case c.send <- data:
+		return
+	default:
+	}
+
+	if data.closeCode != 0 {
+		// The connection has to be closed in any case, even without telling the client why
+		log.Println(w.Key, key, "send queue full, closing")
+		w.Remove(key)
+		return
+	}
+
+	switch config.SendQueueOverflow {
+	case overflowDisconnect:
+		log.Println(w.Key, key, "send queue full, disconnecting")
+		w.Remove(key)
+	default:
+		log.Println(w.Key, key, "send queue full, resyncing")
+		w.resync(key, c)
+	}
+}
+
+// sendError queues an error for a single connection.
+// If closeCode is not 0, the connection is closed with that code after the error is sent.
+// Caller must hold w.l.
+func (w *writer) sendError(key, errorCode string, closeCode int) {
+	w.send(key, command{Comm: commandError, Data: errorCode})
+	if closeCode != 0 {
+		w.send(key, command{Data: errorCode, closeCode: closeCode})
+	}
+}
+
+// resync drops all queued messages of a connection and replaces them by the current state of the writer.
+// If the connection was about to be closed, it is closed instead.
+// Caller must hold w.l.
+func (w *writer) resync(key string, c *connection) {
+	for {
+		select {
+		case data := <-c.send:
+			if data.closeCode != 0 {
+				w.Remove(key)
+				return
+			}
+			continue
+		default:
+		}
+		break
+	}
+
+	w.currentL.Lock()
+	c.send <- command{Comm: commandInitialSend, Data: w.current, Revision: w.revision}
+	w.currentL.Unlock()
+	c.send <- command{Comm: commandNumberUser, Data: strconv.Itoa(w.userCount())}
+	if w.active == key {
+		c.send <- command{Comm: commandGetWrite}
+	} else {
+		c.send <- command{Comm: commandStopWrite}
+	}
+}
+
+// expireSessions removes all sessions which left longer than the grace window ago.
+// Caller must hold w.l.
+func (w *writer) expireSessions() {
+	grace := time.Duration(config.ResumeGraceSeconds) * time.Second
+	for token, s := range w.sessions {
+		if !s.left.IsZero() && time.Since(s.left) > grace {
+			delete(w.sessions, token)
+		}
+	}
+}
+
+// acceptRevision reports whether a state based on revision base can be stored for the session.
+// This is the case if no other session changed the document since base.
+// Caller must hold w.currentL.
+func (w *writer) acceptRevision(token string, base int) bool {
+	if base == w.revision {
+		return true
+	}
+	return token == w.revisionAuthor && base >= w.revisionRunStart && base < w.revision
+}
+
 func (w *writer) CanBeDeleted() bool {
 	w.l.Lock()
 	defer w.l.Unlock()
@@ -124,32 +447,327 @@ func (w *writer) CanBeDeleted() bool {
 	return len(w.connections) == 0
 }
 
+// Delete stops the writer and saves its state.
+// The state is saved without holding the writer lock, so a slow DataSafe does not block the connections.
 func (w *writer) Delete() error {
+	w.l.Lock()
+	log.Println(w.Key, "done")
+	w.logCompressionStats()
+
+	w.cancel()
+	w.leaveBus()
+	w.l.Unlock()
+
+	err := w.save()
+	clusterRelease(w.Key)
+	return err
+}
+
+// sendACL sends the ACL of the document to a connection of an owner.
+func (w *writer) sendACL(key string) {
 	w.l.Lock()
 	defer w.l.Unlock()
 
-	log.Println(w.Key, "done")
+	c := w.connections[key]
+	if c == nil || !hasRole(c.role, roleOwner) {
+		w.sendError(key, errorForbidden, 0)
+		return
+	}
+	a, ok, err := loadACL(w.Key)
+	if err != nil {
+		log.Println(w.Key, key, "can not load ACL:", err)
+		return
+	}
+	if !ok {
+		a = documentACL{Public: config.DefaultRole}
+	}
+	b, err := json.Marshal(&a)
+	if err != nil {
+		log.Println(w.Key, key, "can not encode ACL:", err)
+		return
+	}
+	w.send(key, command{Comm: commandACL, Data: string(b)})
+}
+
+// setACL replaces the ACL of the document on request of an owner.
+func (w *writer) setACL(key, data string) {
+	w.l.Lock()
+	defer w.l.Unlock()
+
+	c := w.connections[key]
+	if c == nil || !hasRole(c.role, roleOwner) {
+		w.sendError(key, errorForbidden, 0)
+		return
+	}
+	var a documentACL
+	err := json.Unmarshal([]byte(data), &a)
+	if err == nil {
+		err = a.validate()
+	}
+	if err != nil {
+		log.Println(w.Key, key, "invalid ACL:", err)
+		w.sendError(key, errorInvalidACL, 0)
+		return
+	}
+	err = saveACL(w.Key, a)
+	if err != nil {
+		log.Println(w.Key, key, "can not save ACL:", err)
+		return
+	}
+	log.Println(w.Key, key, "changed ACL")
+	w.auditConnection(auditACL, key, data)
+	w.applyACL(a)
+	w.publish(busMessage{Type: busACL, Data: data})
+}
+
+// applyACL updates the roles of all connections after the ACL changed.
+// Connections losing access are closed, the active connection loses the write permission if it is no editor anymore.
+// Caller must hold w.l.
+func (w *writer) applyACL(a documentACL) {
+	for k, c := range w.connections {
+		role := a.role(c.identity)
+		if role == c.role {
+			continue
+		}
+		c.role = role
+		if !hasRole(role, roleViewer) {
+			w.sendError(k, errorForbidden, websocket.ClosePolicyViolation)
+			continue
+		}
+		if w.active == k && !hasRole(role, roleEditor) {
+			w.send(k, command{Comm: commandStopWrite})
+			w.active = ""
+		}
+		w.send(k, command{Comm: commandRole, Data: role})
+	}
+}
+
+// Drain prepares the writer for a shutdown.
+// All clients are notified and the active client loses its write permission.
+// Drain waits up to timeout for the final state of the active client, saves the writer and closes all connections.
+func (w *writer) Drain(timeout time.Duration) error {
+	w.changeActiveLock.Lock()
+	defer w.changeActiveLock.Unlock()
+
+	w.l.Lock()
+	w.draining = true
+	w.broadcast(command{Comm: commandShutdown}, "")
+	var final chan struct{}
+	if w.connections[w.active] != nil {
+		// The client sends its final state when losing the write permission
+		final = make(chan struct{})
+		w.finalState = final
+		w.send(w.active, command{Comm: commandStopWrite})
+	}
+	w.l.Unlock()
+
+	if final != nil {
+		select {
+		case <-final:
+		case <-time.After(timeout):
+			log.Println(w.Key, "no final state before shutdown")
+		}
+	}
+
+	w.l.Lock()
+	w.active = ""
+	w.finalState = nil
+	w.l.Unlock()
+
+	err := w.Delete()
+
+	w.l.Lock()
+	closing := make([]*connection, 0, len(w.connections))
+	for k := range w.connections {
+		closing = append(closing, w.connections[k])
+		w.send(k, command{Data: "shutdown", closeCode: websocket.CloseServiceRestart})
+	}
+	w.l.Unlock()
+
+	deadline := time.After(drainCloseTimeout)
+	for i := range closing {
+		select {
+		case <-closing[i].done:
+		case <-deadline:
+			return err
+		}
+	}
+	return err
+}
+
+// save stores the current state in the DataSafe.
+// If the DataSafe supports versions, the state is only saved if it changed and conflicting saves of others are detected.
+func (w *writer) save() error {
+	w.currentL.Lock()
+	current, revision, version, saved := w.current, w.revision, w.version, w.savedRevision
+	editors := w.editors
+	w.editors = make(map[string]bool)
+	w.currentL.Unlock()
+
+	newVersion, err := w.store(current, revision, version, saved)
+	if err != nil {
+		// The changes are still not saved
+		w.currentL.Lock()
+		for e := range editors {
+			w.editors[e] = true
+		}
+		w.currentL.Unlock()
+		return err
+	}
+
+	w.currentL.Lock()
+	w.version = newVersion
+	if w.savedRevision < revision {
+		w.savedRevision = revision
+	}
+	w.currentL.Unlock()
+
+	if revision != saved {
+		w.auditSave(revision, editors)
+	}
+	return nil
+}
+
+// store writes the state to the DataSafe and returns its new version.
+func (w *writer) store(current string, revision int, version string, saved int) (string, error) {
+	vds, ok := ds.(registry.VersionedDataSafe)
+	if !ok {
+		return "", ds.SaveWriter(w.Key, current)
+	}
+	if revision == saved {
+		// Nothing changed since the last save
+		return version, nil
+	}
+
+	newVersion, err := vds.SaveWriterVersion(w.Key, current, version)
+	if errors.Is(err, registry.ErrVersionConflict) {
+		newVersion, err = w.resolveConflict(vds, current)
+	}
+	return newVersion, err
+}
+
+// auditSave records a save of the writer together with the users who changed it.
+func (w *writer) auditSave(revision int, editors map[string]bool) {
+	names := make([]string, 0, len(editors))
+	for e := range editors {
+		if e == "" {
+			e = "anonymous"
+		}
+		names = append(names, e)
+	}
+	sort.Strings(names)
+	detail := fmt.Sprintf("revision %d", revision)
+	if len(names) != 0 {
+		// Changes received from other instances have no local editor
+		detail = fmt.Sprintf("%s, changed by: %s", detail, strings.Join(names, ", "))
+	}
+	audit(registry.AuditEvent{Action: auditSave, Document: w.Key, Detail: detail})
+}
+
+// resolveConflict saves the current state although the saved state was changed by someone else since it was loaded.
+// The state of the other party is kept under a separate key, so no data is lost.
+func (w *writer) resolveConflict(vds registry.VersionedDataSafe, current string) (string, error) {
+	stored, storedVersion, err := vds.LoadWriterVersion(w.Key)
+	if err != nil {
+		return "", fmt.Errorf("can not load conflicting state: %w", err)
+	}
+	if stored == current {
+		// Someone else saved the same state
+		return storedVersion, nil
+	}
+
+	// The random part keeps conflicts within the same second apart
+	conflictKey := strings.Join([]string{w.Key, "~conflict-", time.Now().Format("20060102-150405"), "-", RandomString()}, "")
+	log.Printf("%s save conflict: saved state was changed by someone else, keeping it as %s", w.Key, conflictKey)
+
+	// The copy must not be more accessible than the document
+	a, ok, err := loadACL(w.Key)
+	if err != nil {
+		return "", fmt.Errorf("can not copy ACL to conflicting state: %w", err)
+	}
+	if ok {
+		err = saveACL(conflictKey, a)
+		if err != nil {
+			return "", fmt.Errorf("can not copy ACL to conflicting state: %w", err)
+		}
+	}
+	err = ds.SaveWriter(conflictKey, stored)
+	if err != nil {
+		return "", fmt.Errorf("can not save conflicting state: %w", err)
+	}
+	return vds.SaveWriterVersion(w.Key, current, storedVersion)
+}
+
+// leaveBus tells the other instances that this instance has no connections anymore and stops listening to the bus.
+func (w *writer) leaveBus() {
+	w.publish(busMessage{Type: busUsers, Users: 0})
+	if w.sub == nil {
+		return
+	}
+	err := w.sub.Unsubscribe()
+	if err != nil {
+		log.Println(w.Key, "can not unsubscribe from bus:", err)
+	}
+}
+
+// Abandon closes all connections without saving the current state.
+// It is used when the writer is owned by another instance.
+func (w *writer) Abandon() {
+	w.l.Lock()
+	defer w.l.Unlock()
+
+	log.Println(w.Key, "abandoned")
 
 	w.cancel()
-	return ds.SaveWriter(w.Key, w.current)
+	w.leaveBus()
+	for k := range w.connections {
+		w.send(k, command{Data: "owner changed", closeCode: websocket.CloseServiceRestart})
+	}
 }
 
+// logCompressionStats logs and resets the traffic statistics of the writer.
+func (w *writer) logCompressionStats() {
+	messages := w.stats.messages.Swap(0)
+	compressed := w.stats.compressed.Swap(0)
+	raw := w.stats.rawBytes.Swap(0)
+	sent := w.stats.sentBytes.Swap(0)
+	if messages == 0 || raw == 0 {
+		return
+	}
+	log.Printf("%s compression: %d/%d messages compressed, %d bytes raw, %d bytes sent (ratio %.3f)", w.Key, compressed, messages, raw, sent, float64(sent)/float64(raw))
+}
+
+// userCount returns the number of connections of the writer on all instances.
+// Caller must hold w.l.
+func (w *writer) userCount() int {
+	n := len(w.connections)
+	for _, remote := range w.remoteUsers {
+		n += remote
+	}
+	return n
+}
+
+// broadcastUsers sends the current number of connections to all connections.
+// Caller must hold w.l.
+func (w *writer) broadcastUsers() {
+	w.broadcast(command{Comm: commandNumberUser, Data: strconv.Itoa(w.userCount())}, "")
+}
+
+// push queues a command for all connections except sender.
 func (w *writer) push(data command, sender string) {
-	go func() {
-		w.l.Lock()
-		defer w.l.Unlock()
-		for k := range w.connections {
-			if k != sender {
-				err := w.connections[k].WriteJSON(&data)
-				if err != nil {
-					if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
-						log.Println(w.Key, k, "write command:", err)
-					}
-					w.Remove(k)
-				}
-			}
+	w.l.Lock()
+	defer w.l.Unlock()
+	w.broadcast(data, sender)
+}
+
+// broadcast queues a command for all connections except sender.
+// Caller must hold w.l.
+func (w *writer) broadcast(data command, sender string) {
+	for k := range w.connections {
+		if k != sender {
+			w.send(k, data)
 		}
-	}()
+	}
 }
 
 func (w *writer) changeActive(key string) {
@@ -158,62 +776,162 @@ func (w *writer) changeActive(key string) {
 		defer w.changeActiveLock.Unlock()
 
 		w.l.Lock()
-		conn := w.connections[w.active]
-		if conn != nil {
-			c := command{Comm: commandStopWrite}
-			err := conn.WriteJSON(&c)
-			if err != nil {
-				w.Remove(key)
-			}
+		if w.draining {
+			w.l.Unlock()
+			return
 		}
+		stopped := w.active
+		w.send(stopped, command{Comm: commandStopWrite})
+		w.publish(busMessage{Type: busStopWrite})
 		w.l.Unlock()
 
-		time.Sleep(time.Duration(config.SyncSeconds) * time.Second)
+		time.Sleep(syncInterval())
 
 		w.l.Lock()
 		defer w.l.Unlock()
 
-		w.active = key
-		conn = w.connections[key]
-		if conn != nil {
-			c := command{Comm: commandGetWrite}
-			err := conn.WriteJSON(&c)
-			if err != nil {
-				w.Remove(key)
-			}
+		if w.draining {
+			return
 		}
+
+		if w.active != stopped && w.active != key {
+			// The permission might have been resumed by a reconnecting client in the meantime
+			w.send(w.active, command{Comm: commandStopWrite})
+		}
+
+		w.active = key
+		w.send(key, command{Comm: commandGetWrite})
+		w.publish(busMessage{Type: busActive, Active: busQualify(key)})
+		w.auditConnection(auditWriteToken, key, "")
 		log.Println(w.Key, key, "active")
 	}()
 }
 
-func writerWorker(conn *websocket.Conn, key string, w *writer) {
+func writerWorker(conn *websocket.Conn, key, client string, w *writer) {
 	for {
 		time.Sleep(10 * time.Millisecond)
-		var c command
-		err := conn.ReadJSON(&c)
+		_, r, err := conn.NextReader()
 		if err != nil {
 			// Stop on error - something went wrong
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure, websocket.CloseServiceRestart) {
 				log.Println(w.Key, key, "socket error:", err)
 			}
 			w.Remove(key)
 			return
 		}
+		b, err := io.ReadAll(io.LimitReader(r, config.MaxMessageBytes+1))
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure, websocket.CloseServiceRestart) {
+				log.Println(w.Key, key, "socket error:", err)
+			}
+			w.Remove(key)
+			return
+		}
+		if int64(len(b)) > config.MaxMessageBytes {
+			log.Println(w.Key, key, "message too large")
+			w.l.Lock()
+			w.sendError(key, errorMessageTooLarge, websocket.CloseMessageTooBig)
+			w.l.Unlock()
+			return
+		}
+		if ok, _ := messageLimiter.Allow(client); !ok {
+			log.Println(w.Key, key, "message rate limit exceeded by", client)
+			w.l.Lock()
+			w.sendError(key, errorRateLimited, websocket.CloseTryAgainLater)
+			w.l.Unlock()
+			return
+		}
+		var c command
+		err = json.Unmarshal(b, &c)
+		if err != nil {
+			log.Println(w.Key, key, "can not parse command:", err)
+			w.Remove(key)
+			return
+		}
 		switch c.Comm {
 		case commandInitialSend:
+			if len(c.Data) > config.MaxDocumentBytes {
+				log.Println(w.Key, key, "document too large:", len(c.Data))
+				w.l.Lock()
+				w.sendError(key, errorDocumentTooLarge, 0)
+				w.l.Unlock()
+				continue
+			}
+			data, err := NormaliseDelta(c.Data)
+			if err != nil {
+				log.Println(w.Key, key, "invalid document:", err)
+				w.l.Lock()
+				w.sendError(key, errorInvalidDocument, 0)
+				w.l.Unlock()
+				continue
+			}
 			w.l.Lock()
 			currentActive := w.active
+			token := w.connSession[key]
+			var user string
+			if c := w.connections[key]; c != nil {
+				user = c.identity.User
+			}
 			w.l.Unlock()
 			if currentActive != key {
 				w.Remove(key)
 				return
 			}
 			w.currentL.Lock()
-			w.current = c.Data
+			if !w.acceptRevision(token, c.Revision) {
+				conflict := command{Comm: commandConflict, Data: w.current, Revision: w.revision}
+				w.currentL.Unlock()
+				log.Println(w.Key, key, "revision conflict:", c.Revision)
+				w.l.Lock()
+				w.send(key, conflict)
+				w.l.Unlock()
+				continue
+			}
+			if w.revisionAuthor != token {
+				w.revisionAuthor = token
+				w.revisionRunStart = c.Revision
+			}
+			w.revision++
+			w.current = data
+			w.editors[user] = true
+			sent, sequence := c.Data, c.Sequence
+			c = command{Comm: commandInitialSend, Data: data, Revision: w.revision}
 			w.currentL.Unlock()
 			w.push(c, key)
+			w.publish(busMessage{Type: busState, Data: data, Revision: c.Revision, Author: token})
+			w.l.Lock()
+			if !equalDelta(sent, data) {
+				// Otherwise the client would keep editing content which differs from what everyone else sees
+				w.send(key, command{Comm: commandNormalised, Data: data, Sequence: sequence})
+			}
+			if w.finalState != nil && w.active == key {
+				close(w.finalState)
+				w.finalState = nil
+			}
+			w.l.Unlock()
 		case commandAskWrite:
-			w.changeActive(key)
+			w.l.Lock()
+			editor := w.connections[key] != nil && hasRole(w.connections[key].role, roleEditor)
+			if !editor {
+				w.sendError(key, errorForbidden, 0)
+			}
+			w.l.Unlock()
+			if editor {
+				w.changeActive(key)
+			}
+		case commandExported:
+			switch c.Data {
+			case exportHTML, exportDelta:
+				w.l.Lock()
+				w.auditConnection(auditExport, key, c.Data)
+				w.l.Unlock()
+			default:
+				log.Println(w.Key, key, "unknown export format:", c.Data)
+			}
+		case commandGetACL:
+			w.sendACL(key)
+		case commandSetACL:
+			w.setACL(key, c.Data)
 		default:
 			log.Println(w.Key, key, "unknown control:", c.Comm)
 		}
@@ -221,19 +939,17 @@ func writerWorker(conn *websocket.Conn, key string, w *writer) {
 }
 
 func (w *writer) backupWorker() {
-	t := time.NewTicker(time.Duration(config.GCMinutes) * time.Minute)
+	t := time.NewTicker(gcInterval())
 	for {
 		select {
 		case <-t.C:
+			t.Reset(gcInterval())
 			log.Println(w.Key, "starting backup")
-			w.currentL.Lock()
-			current := w.current
-			w.currentL.Unlock()
-
-			err := ds.SaveWriter(w.Key, current)
+			err := w.save()
 			if err != nil {
 				log.Println(w.Key, "can not backup data:", err)
 			}
+			w.logCompressionStats()
 		case <-w.ctx.Done():
 			t.Stop()
 			return
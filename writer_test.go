@@ -0,0 +1,543 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2026 Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Top-Ranger/writergo/datasafe"
+	"github.com/Top-Ranger/writergo/registry"
+	"github.com/gorilla/websocket"
+)
+
+var testSetup sync.Once
+
+// testGlobals sets the config, the DataSafe and the bus used by all tests.
+func testGlobals() {
+	// Goroutines of writers of earlier tests might still read the globals
+	testSetup.Do(func() {
+		config = defaultConfig()
+		config.SendQueueSize = 64
+		config.SendQueueOverflow = overflowResync
+		config.MaxMessageBytes = 1 << 20
+		config.MaxDocumentBytes = 1 << 19
+		config.ResumeGraceSeconds = 30
+		ds, _ = registry.GetDataSafe("Nil")
+		messageBus, _ = registry.GetBus("Local")
+	})
+}
+
+// testWriter returns a server adding all websocket connections to a new writer.
+// Connections get the role given in the query parameter "role", editor by default.
+func testWriter(t *testing.T) (*httptest.Server, *writer) {
+	t.Helper()
+	testGlobals()
+
+	w := new(writer)
+	w.Key = strings.ReplaceAll(t.Name(), "/", "_")
+	w.Init()
+	t.Cleanup(w.Abandon)
+
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(rw, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		role := r.URL.Query().Get("role")
+		if role == "" {
+			role = roleEditor
+		}
+		err = w.AddNew(conn, r.URL.Query().Get("session"), registry.Identity{}, role, "127.0.0.1")
+		if err != nil {
+			t.Error(err)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s, w
+}
+
+// dialWriter opens a connection to a server returned by testWriter.
+func dialWriter(t *testing.T, s *httptest.Server, session string) *websocket.Conn {
+	t.Helper()
+	return dialWriterAs(t, s, session, "")
+}
+
+// dialWriterAs opens a connection with the given role to a server returned by testWriter.
+func dialWriterAs(t *testing.T, s *httptest.Server, session, role string) *websocket.Conn {
+	t.Helper()
+	u := strings.Join([]string{"ws", strings.TrimPrefix(s.URL, "http"), "/?session=", session, "&role=", role}, "")
+	conn, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// readCommands reads the next n commands except commandNumberUser.
+func readCommands(t *testing.T, conn *websocket.Conn, n int) []command {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var commands []command
+	for len(commands) < n {
+		var c command
+		err := conn.ReadJSON(&c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Comm == commandNumberUser {
+			continue
+		}
+		commands = append(commands, c)
+	}
+	return commands
+}
+
+func TestResumeWithRole(t *testing.T) {
+	s, w := testWriter(t)
+
+	conn := dialWriter(t, s, "")
+	initial := readCommands(t, conn, 2)
+	if initial[0].Comm != commandRole || initial[1].Comm != commandInitialSend {
+		t.Fatalf("got %s, %s, want role before initial state", initial[0].Comm, initial[1].Comm)
+	}
+	session := initial[1].Session
+	if session == "" {
+		t.Fatal("initial state has no session")
+	}
+
+	err := conn.WriteJSON(command{Comm: commandAskWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := readCommands(t, conn, 1)[0]; c.Comm != commandGetWrite {
+		t.Fatalf("got %s, want %s", c.Comm, commandGetWrite)
+	}
+
+	// Drop the connection without closing it properly
+	conn.UnderlyingConn().Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w.l.Lock()
+		n := w.userCount()
+		w.l.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("connection was not removed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	conn = dialWriter(t, s, session)
+	defer conn.Close()
+	resumed := readCommands(t, conn, 3)
+	if resumed[0].Comm != commandRole {
+		t.Errorf("got %s, want %s first", resumed[0].Comm, commandRole)
+	}
+	if resumed[1].Comm != commandInitialSend || resumed[1].Session != session {
+		t.Errorf("got %s with session '%s', want initial state of session '%s'", resumed[1].Comm, resumed[1].Session, session)
+	}
+	if resumed[2].Comm != commandGetWrite {
+		t.Errorf("got %s, want %s directly after the initial state", resumed[2].Comm, commandGetWrite)
+	}
+}
+
+func TestDocumentRole(t *testing.T) {
+	testGlobals()
+	key := t.Name()
+	err := saveACL(key, documentACL{
+		Users:  map[string]string{"alice": roleOwner, "bob": roleViewer},
+		Groups: map[string]string{"staff": roleEditor},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		key  string
+		id   registry.Identity
+		want string
+	}{
+		{"owner", key, registry.Identity{User: "alice"}, roleOwner},
+		{"owner with read token", key, registry.Identity{User: "alice", Scopes: []string{scopeRead}}, roleViewer},
+		{"owner with write token", key, registry.Identity{User: "alice", Scopes: []string{scopeWrite}}, roleEditor},
+		{"owner with admin token", key, registry.Identity{User: "alice", Scopes: []string{scopeAdmin}}, roleOwner},
+		{"viewer", key, registry.Identity{User: "bob"}, roleViewer},
+		{"viewer with admin token", key, registry.Identity{User: "bob", Scopes: []string{scopeAdmin}}, roleViewer},
+		{"group", key, registry.Identity{User: "carol", Groups: []string{"staff"}}, roleEditor},
+		{"viewer in group", key, registry.Identity{User: "bob", Groups: []string{"staff"}}, roleEditor},
+		{"non-member", key, registry.Identity{User: "mallory"}, roleNone},
+		{"anonymous", key, registry.Identity{}, roleNone},
+		{"no ACL", "TestDocumentRole-new", registry.Identity{}, config.DefaultRole},
+		{"no ACL with read token", "TestDocumentRole-new", registry.Identity{User: "bot", Scopes: []string{scopeRead}}, roleViewer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role, err := documentRole(tt.key, tt.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if role != tt.want {
+				t.Errorf("got %s, want %s", role, tt.want)
+			}
+		})
+	}
+}
+
+func TestRootHandleRoles(t *testing.T) {
+	testGlobals()
+	key := t.Name()
+	err := saveACL(key, documentACL{Users: map[string]string{"alice": roleOwner, "bob": roleViewer}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		id   registry.Identity
+		want int
+	}{
+		{"owner", registry.Identity{User: "alice"}, http.StatusOK},
+		{"viewer", registry.Identity{User: "bob"}, http.StatusOK},
+		{"viewer token", registry.Identity{User: "bob", Scopes: []string{scopeRead}}, http.StatusOK},
+		{"non-member", registry.Identity{User: "mallory"}, http.StatusForbidden},
+		{"anonymous", registry.Identity{}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, strings.Join([]string{"/", key}, ""), nil)
+			rootHandle(rec, r.WithContext(context.WithValue(r.Context(), identityContextKey{}, tt.id)))
+			if rec.Code != tt.want {
+				t.Errorf("got %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestViewerCanNotWrite(t *testing.T) {
+	s, w := testWriter(t)
+	conn := dialWriterAs(t, s, "", roleViewer)
+	defer conn.Close()
+	if c := readCommands(t, conn, 2)[0]; c.Comm != commandRole || c.Data != roleViewer {
+		t.Fatalf("got %+v, want role %s", c, roleViewer)
+	}
+
+	err := conn.WriteJSON(command{Comm: commandAskWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := readCommands(t, conn, 1)[0]; c.Comm != commandError || c.Data != errorForbidden {
+		t.Fatalf("got %+v, want error %s", c, errorForbidden)
+	}
+
+	err = conn.WriteJSON(command{Comm: commandInitialSend, Data: `{"ops":[{"insert":"changed\n"}]}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The connection is closed without receiving the write permission
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var c command
+		err = conn.ReadJSON(&c)
+		if err != nil {
+			break
+		}
+		if c.Comm == commandGetWrite {
+			t.Fatal("viewer got the write permission")
+		}
+	}
+	if websocket.IsUnexpectedCloseError(err, websocket.CloseAbnormalClosure, websocket.CloseNormalClosure) {
+		t.Errorf("connection closed with %v", err)
+	}
+
+	w.currentL.Lock()
+	defer w.currentL.Unlock()
+	if w.current != "" || w.revision != 0 {
+		t.Errorf("state of viewer was accepted: %s (revision %d)", w.current, w.revision)
+	}
+}
+
+func TestApplyACL(t *testing.T) {
+	_, w := testWriter(t)
+
+	tests := []struct {
+		key      string
+		identity registry.Identity
+		role     string
+		want     string   // role after the change
+		commands []string // commands sent because of the change
+	}{
+		{"unchanged", registry.Identity{User: "alice"}, roleOwner, roleOwner, nil},
+		{"downgraded", registry.Identity{User: "bob"}, roleEditor, roleViewer, []string{commandStopWrite, commandRole}},
+		{"upgraded", registry.Identity{User: "carol"}, roleViewer, roleEditor, []string{commandRole}},
+		{"removed", registry.Identity{User: "dave"}, roleEditor, roleNone, []string{commandError, ""}},
+		{"token", registry.Identity{User: "alice", Scopes: []string{scopeRead}}, roleViewer, roleViewer, nil},
+	}
+	connections := make(map[string]*connection)
+	for _, tt := range tests {
+		connections[tt.key] = testConnection(t, w, tt.key)
+	}
+
+	w.l.Lock()
+	for _, tt := range tests {
+		connections[tt.key].identity = tt.identity
+		connections[tt.key].role = tt.role
+	}
+	w.active = "downgraded"
+	w.applyACL(documentACL{Users: map[string]string{"alice": roleOwner, "bob": roleViewer, "carol": roleEditor}})
+	active := w.active
+	w.l.Unlock()
+
+	if active != "" {
+		t.Errorf("active connection is %s, want none", active)
+	}
+	for _, tt := range tests {
+		c := connections[tt.key]
+		var got []string
+		for len(c.send) > 0 {
+			got = append(got, (<-c.send).Comm)
+		}
+		w.l.Lock()
+		role := c.role
+		w.l.Unlock()
+		if role != tt.want || strings.Join(got, ",") != strings.Join(tt.commands, ",") {
+			t.Errorf("%s: got role %s and %v, want %s and %v", tt.key, role, got, tt.want, tt.commands)
+		}
+	}
+}
+
+func TestClaimDocument(t *testing.T) {
+	testGlobals()
+	claimed := strings.Join([]string{t.Name(), "-claimed"}, "")
+	bob := documentACL{Users: map[string]string{"bob": roleOwner}}
+	err := saveACL(claimed, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		key   string
+		id    registry.Identity
+		owner string // owner after claiming, empty for no ACL
+	}{
+		{"existing ACL", claimed, registry.Identity{User: "alice"}, "bob"},
+		{"existing ACL with admin token", claimed, registry.Identity{User: "alice", Scopes: []string{scopeAdmin}}, "bob"},
+		{"new document", strings.Join([]string{t.Name(), "-new"}, ""), registry.Identity{User: "alice"}, "alice"},
+		{"anonymous", strings.Join([]string{t.Name(), "-anonymous"}, ""), registry.Identity{}, ""},
+		{"write token", strings.Join([]string{t.Name(), "-token"}, ""), registry.Identity{User: "alice", Scopes: []string{scopeWrite}}, ""},
+		{"admin token", strings.Join([]string{t.Name(), "-admin"}, ""), registry.Identity{User: "alice", Scopes: []string{scopeAdmin}}, "alice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := claimDocument(tt.key, tt.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			a, ok, err := loadACL(tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			owner := ""
+			for user, role := range a.Users {
+				if role == roleOwner {
+					owner = user
+				}
+			}
+			if ok != (tt.owner != "") || owner != tt.owner || len(a.Users) > 1 {
+				t.Errorf("got ACL %+v (%t), want owner '%s'", a, ok, tt.owner)
+			}
+		})
+	}
+}
+
+func TestNormalisedStateSentBack(t *testing.T) {
+	s, w := testWriter(t)
+	conn := dialWriter(t, s, "")
+	defer conn.Close()
+	readCommands(t, conn, 2)
+
+	err := conn.WriteJSON(command{Comm: commandAskWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := readCommands(t, conn, 1)[0]; c.Comm != commandGetWrite {
+		t.Fatalf("got %s, want %s", c.Comm, commandGetWrite)
+	}
+
+	for i, data := range []string{
+		`{"ops":[{"insert":"a"},{"insert":"b\n"}]}`,
+		// Only the encoding differs, so the state is not sent back
+		`{ "ops": [ { "insert": "ab\n" } ] }`,
+		`{"ops":[{"insert":"c","attributes":{"bold":null}},{"insert":"\n"}]}`,
+	} {
+		err = conn.WriteJSON(command{Comm: commandInitialSend, Data: data, Sequence: i + 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []command{
+		{Comm: commandNormalised, Data: `{"ops":[{"insert":"ab\n"}]}`, Sequence: 1},
+		{Comm: commandNormalised, Data: `{"ops":[{"insert":"c\n"}]}`, Sequence: 3},
+	} {
+		if c := readCommands(t, conn, 1)[0]; c != want {
+			t.Errorf("got %+v, want %+v", c, want)
+		}
+	}
+
+	w.currentL.Lock()
+	defer w.currentL.Unlock()
+	if w.current != `{"ops":[{"insert":"c\n"}]}` {
+		t.Errorf("current state is %s", w.current)
+	}
+}
+
+// testConnection adds a connection to the writer without a send worker, so its queue is never emptied.
+func testConnection(t *testing.T, w *writer, key string) *connection {
+	t.Helper()
+	conns := make(chan *websocket.Conn, 1)
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(rw, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(s.Close)
+	client := dialWriter(t, s, "")
+	t.Cleanup(func() { client.Close() })
+
+	c := &connection{conn: <-conns, send: make(chan command, minSendQueueSize), done: make(chan struct{})}
+	w.l.Lock()
+	w.connections[key] = c
+	w.l.Unlock()
+	return c
+}
+
+// waitRemoved waits until the connection is removed from the writer.
+func waitRemoved(t *testing.T, w *writer, key string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w.l.Lock()
+		c := w.connections[key]
+		w.l.Unlock()
+		if c == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("connection was not removed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// blockingDataSafe blocks all saves until release is closed.
+type blockingDataSafe struct {
+	datasafe.Nil
+	saving  chan string
+	release chan struct{}
+}
+
+func (b *blockingDataSafe) SaveWriter(key, data string) error {
+	b.saving <- key
+	<-b.release
+	return nil
+}
+
+func TestCollectWritersSavesWithoutLocks(t *testing.T) {
+	b := &blockingDataSafe{saving: make(chan string, 1), release: make(chan struct{})}
+	useDataSafe(t, b)
+	key := t.Name()
+
+	w := new(writer)
+	w.Key = key
+	w.Init()
+	writerMapLock.Lock()
+	writerMap[key] = w
+	writerMapLock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		collectWriters()
+		close(done)
+	}()
+	if got := <-b.saving; got != key {
+		t.Fatalf("saving %s, want %s", got, key)
+	}
+
+	// Neither the writer map nor the writer is locked while saving
+	writerMapLock.Lock()
+	removed := writerMap[key] == nil
+	deleting := writerDeleting[key] != nil
+	writerMapLock.Unlock()
+	if !removed || !deleting {
+		t.Errorf("writer removed %t, marked as deleting %t", removed, deleting)
+	}
+	w.l.Lock()
+	w.l.Unlock()
+
+	close(b.release)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("collecting writers did not finish")
+	}
+	writerMapLock.Lock()
+	defer writerMapLock.Unlock()
+	if writerDeleting[key] != nil {
+		t.Error("writer still marked as deleting")
+	}
+}
+
+func TestCloseWithFullQueue(t *testing.T) {
+	_, w := testWriter(t)
+	testConnection(t, w, "full")
+
+	w.l.Lock()
+	for i := 0; i < minSendQueueSize-1; i++ {
+		w.send("full", command{Comm: commandNumberUser})
+	}
+	// The error fills the queue, so the close command does not fit
+	w.sendError("full", errorRateLimited, websocket.CloseTryAgainLater)
+	w.l.Unlock()
+	waitRemoved(t, w, "full")
+}
+
+func TestResyncKeepsClose(t *testing.T) {
+	_, w := testWriter(t)
+	testConnection(t, w, "closing")
+
+	w.l.Lock()
+	w.sendError("closing", errorRateLimited, websocket.CloseTryAgainLater)
+	for i := 0; i < minSendQueueSize; i++ {
+		// Overflows the queue, which resyncs the connection
+		w.send("closing", command{Comm: commandNumberUser})
+	}
+	w.l.Unlock()
+	waitRemoved(t, w, "closing")
+}